@@ -44,6 +44,8 @@ This can be useful for development and debugging purposes.`,
 
 		var signalChan = make(chan os.Signal, 1)
 		signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+		var reloadChan = make(chan os.Signal, 1)
+		signal.Notify(reloadChan, syscall.SIGHUP)
 
 		kubeFs := kubefs.NewKubeFS(config)
 		stopConfigWatch := make(chan struct{})
@@ -56,17 +58,20 @@ This can be useful for development and debugging purposes.`,
 			log.Fatalf("Mount fail: %v\n", err)
 		}
 
-		if kubeFs.IsClusterScope() {
-			kubeFs.AddNamespace(context.Background(), "clusterwide", true)
-		} else {
-			for _, ns := range kubeFs.AllowedNamespaces() {
-				kubeFs.AddNamespace(context.Background(), ns, false)
-			}
-		}
+		kubeFs.ReconcileNamespaces(context.Background())
 		kubefs.Inform(kubeFs)
 
-		<-signalChan
+		for waiting := true; waiting; {
+			select {
+			case <-reloadChan:
+				log.Printf("Received SIGHUP")
+				reloadConfig(resolvedConfigPath, kubeFs)
+			case <-signalChan:
+				waiting = false
+			}
+		}
 		close(stopConfigWatch)
+		kubeFs.Shutdown()
 		err = server.Unmount()
 		if err != nil {
 			log.Fatal(err)
@@ -125,16 +130,7 @@ func startConfigWatcher(path string, kubeFs *kubefs.KubeFS, stopCh <-chan struct
 				if !shouldReloadConfig(event, path) {
 					continue
 				}
-				config, err := kubefs.LoadConfig(path)
-				if err != nil {
-					log.Printf("Failed to reload config from %s: %v", path, err)
-					continue
-				}
-				kubefs.SetLogLevel(config.LogLevel)
-				oldConfig := kubeFs.GetConfig()
-				kubeFs.SetConfig(config)
-				warnIfScopeChanged(oldConfig, config)
-				log.Printf("Reloaded config from %s", path)
+				reloadConfig(path, kubeFs)
 			case err, ok := <-watcher.Errors:
 				if !ok {
 					return
@@ -145,6 +141,19 @@ func startConfigWatcher(path string, kubeFs *kubefs.KubeFS, stopCh <-chan struct
 	}()
 }
 
+func reloadConfig(path string, kubeFs *kubefs.KubeFS) {
+	config, err := kubefs.LoadConfig(path)
+	if err != nil {
+		log.Printf("Failed to reload config from %s: %v", path, err)
+		return
+	}
+	kubefs.SetLogLevel(config.LogLevel)
+	oldConfig := kubeFs.GetConfig()
+	logScopeChanges(oldConfig, config)
+	kubeFs.ApplyConfig(config)
+	log.Printf("Reloaded config from %s", path)
+}
+
 func shouldReloadConfig(event fsnotify.Event, path string) bool {
 	if filepath.Clean(event.Name) != filepath.Clean(path) {
 		return false
@@ -155,17 +164,18 @@ func shouldReloadConfig(event fsnotify.Event, path string) bool {
 		event.Has(fsnotify.Remove)
 }
 
-func warnIfScopeChanged(oldConfig kubefs.Config, newConfig kubefs.Config) {
+func logScopeChanges(oldConfig kubefs.Config, newConfig kubefs.Config) {
 	if oldConfig.Scope != newConfig.Scope {
-		log.Printf("Scope changed from %s to %s; restart required to apply", oldConfig.Scope, newConfig.Scope)
+		log.Printf("Scope changed from %s to %s; reconciling mounted tree", oldConfig.Scope, newConfig.Scope)
 		return
 	}
-	if !sameNamespaces(oldConfig.Namespaces, newConfig.Namespaces) {
-		log.Printf("Namespaces changed; restart required to apply")
+	if !sameNamespaces(oldConfig.Namespaces, newConfig.Namespaces) || oldConfig.NamespaceSelector != newConfig.NamespaceSelector {
+		log.Printf("Namespaces changed; reconciling mounted tree")
 		return
 	}
-	if !sameRules(oldConfig.AllowRules, newConfig.AllowRules) || !sameRules(oldConfig.DenyRules, newConfig.DenyRules) {
-		log.Printf("Filters changed; restart required to apply")
+	if !sameRules(oldConfig.AllowRules, newConfig.AllowRules) || !sameRules(oldConfig.DenyRules, newConfig.DenyRules) ||
+		!sameRules(oldConfig.ClusterResources, newConfig.ClusterResources) {
+		log.Printf("Filters changed; reconciling mounted tree")
 	}
 }
 
@@ -197,8 +207,20 @@ func sameRule(left kubefs.FilterRule, right kubefs.FilterRule) bool {
 	if !sameNamespaces(left.ApiGroups, right.ApiGroups) {
 		return false
 	}
+	if !sameNamespaces(left.Versions, right.Versions) {
+		return false
+	}
 	if !sameNamespaces(left.Resources, right.Resources) {
 		return false
 	}
-	return true
+	if !sameNamespaces(left.Kinds, right.Kinds) {
+		return false
+	}
+	if !sameNamespaces(left.Namespaces, right.Namespaces) {
+		return false
+	}
+	if !sameNamespaces(left.Names, right.Names) {
+		return false
+	}
+	return left.LabelSelector == right.LabelSelector && left.FieldSelector == right.FieldSelector
 }
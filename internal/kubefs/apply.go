@@ -0,0 +1,524 @@
+package kubefs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// applyDirName is the drop-box directory. Any YAML written there is applied
+// object by object, regardless of the file name, and a <file>.result report
+// is added next to it.
+const applyDirName = ".apply"
+
+const resultSuffix = ".result"
+
+// fieldManager is the field manager used for server-side apply.
+const fieldManager = "kubefs"
+
+// CustomResourceDefinitions are waited for before the rest of a stream is
+// applied, for at most crdEstablishTimeout each.
+const (
+	crdPollInterval     = 250 * time.Millisecond
+	crdEstablishTimeout = 30 * time.Second
+)
+
+// applyOrder lists the kinds other objects commonly depend on, in the order
+// they are applied. Every other kind follows, in file order.
+var applyOrder = []string{
+	"Namespace",
+	"CustomResourceDefinition",
+	"PriorityClass",
+	"StorageClass",
+	"ServiceAccount",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"ConfigMap",
+	"Secret",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"Service",
+}
+
+type applyDir struct {
+	fs.Inode
+	KubeFS *KubeFS
+}
+
+var _ = (fs.NodeGetattrer)((*applyDir)(nil))
+var _ = (fs.NodeCreater)((*applyDir)(nil))
+var _ = (fs.NodeUnlinker)((*applyDir)(nil))
+
+func (d *applyDir) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = fuse.S_IFDIR | 0755
+	return 0
+}
+
+func (d *applyDir) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	Debugf("Create requested: %s/%s", applyDirName, name)
+	if strings.HasSuffix(name, resultSuffix) {
+		return nil, nil, 0, syscall.EPERM
+	}
+	if d.GetChild(name) != nil {
+		return nil, nil, 0, syscall.EEXIST
+	}
+	file := &applyFile{dir: d, name: name, updatedAt: time.Now()}
+	inode := d.NewPersistentInode(ctx, file, fs.StableAttr{Mode: fuse.S_IFREG})
+	d.AddChild(name, inode, false)
+	out.Attr.Mode = fuse.S_IFREG | 0644
+	return inode, &applyHandle{file: file}, fuse.FOPEN_DIRECT_IO, 0
+}
+
+func (d *applyDir) Unlink(ctx context.Context, name string) syscall.Errno {
+	if d.GetChild(name) == nil {
+		return syscall.ENOENT
+	}
+	d.RmChild(name)
+	if !strings.HasSuffix(name, resultSuffix) {
+		d.RmChild(name + resultSuffix)
+	}
+	return 0
+}
+
+// applyFile is a manifest written to the drop-box. It keeps the last content
+// written and the report of the last apply.
+type applyFile struct {
+	fs.Inode
+	dir  *applyDir
+	name string
+
+	mu        sync.Mutex
+	data      []byte
+	report    []byte
+	updatedAt time.Time
+}
+
+var _ = (fs.NodeGetattrer)((*applyFile)(nil))
+var _ = (fs.NodeOpener)((*applyFile)(nil))
+var _ = (fs.NodeSetattrer)((*applyFile)(nil))
+
+func (f *applyFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out.Mode = fuse.S_IFREG | 0644
+	out.Size = uint64(len(f.data))
+	out.Mtime = uint64(f.updatedAt.Unix())
+	out.Ctime = out.Mtime
+	out.Atime = out.Mtime
+	return 0
+}
+
+func (f *applyFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	handle := &applyHandle{file: f}
+	if flags&syscall.O_ACCMODE != syscall.O_RDONLY && flags&syscall.O_TRUNC != 0 {
+		handle.dirty = true
+		return handle, fuse.FOPEN_DIRECT_IO, 0
+	}
+	f.mu.Lock()
+	handle.data = append([]byte(nil), f.data...)
+	f.mu.Unlock()
+	return handle, fuse.FOPEN_DIRECT_IO, 0
+}
+
+func (f *applyFile) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	if in.Valid&fuse.FATTR_SIZE != 0 {
+		handle, ok := fh.(*applyHandle)
+		if !ok {
+			Warnf("Truncate of %s without an open handle is not supported", f.name)
+			return syscall.EPERM
+		}
+		handle.truncate(int(in.Size))
+	}
+	return f.Getattr(ctx, fh, out)
+}
+
+func (f *applyFile) resultReport() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.report
+}
+
+// apply applies every object in data and publishes the report. It returns
+// the errno of the first object that failed.
+func (f *applyFile) apply(ctx context.Context, data []byte) syscall.Errno {
+	f.mu.Lock()
+	f.data = data
+	f.updatedAt = time.Now()
+	f.mu.Unlock()
+
+	outcomes, errno := f.dir.KubeFS.applyManifests(ctx, data)
+	report, err := yaml.Marshal(outcomes)
+	if err != nil {
+		Errorf("Failed to render apply report for %s: %v", f.name, err)
+		return syscall.EIO
+	}
+	f.mu.Lock()
+	f.report = report
+	f.mu.Unlock()
+
+	resultName := f.name + resultSuffix
+	if f.dir.GetChild(resultName) == nil {
+		result := f.dir.NewPersistentInode(ctx, newGeneratedFile(f.resultReport), fs.StableAttr{Mode: fuse.S_IFREG})
+		f.dir.AddChild(resultName, result, false)
+	}
+	return errno
+}
+
+// applyHandle buffers the writes of one open until it is flushed.
+type applyHandle struct {
+	file *applyFile
+
+	mu    sync.Mutex
+	data  []byte
+	dirty bool
+}
+
+var _ = (fs.FileReader)((*applyHandle)(nil))
+var _ = (fs.FileWriter)((*applyHandle)(nil))
+var _ = (fs.FileFlusher)((*applyHandle)(nil))
+
+func (h *applyHandle) Read(ctx context.Context, dest []byte, offset int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if offset > int64(len(h.data)) {
+		return fuse.ReadResultData(nil), 0
+	}
+	end := offset + int64(len(dest))
+	if end > int64(len(h.data)) {
+		end = int64(len(h.data))
+	}
+	return fuse.ReadResultData(append([]byte(nil), h.data[offset:end]...)), 0
+}
+
+func (h *applyHandle) Write(ctx context.Context, data []byte, offset int64) (uint32, syscall.Errno) {
+	if offset < 0 || offset > int64(^uint(0)>>1) {
+		return 0, syscall.EINVAL
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	end := int(offset) + len(data)
+	if end > len(h.data) {
+		newData := make([]byte, end)
+		copy(newData, h.data)
+		h.data = newData
+	}
+	copy(h.data[offset:], data)
+	h.dirty = true
+	return uint32(len(data)), 0
+}
+
+func (h *applyHandle) truncate(size int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if size < len(h.data) {
+		h.data = h.data[:size]
+	} else {
+		newData := make([]byte, size)
+		copy(newData, h.data)
+		h.data = newData
+	}
+	h.dirty = true
+}
+
+func (h *applyHandle) Flush(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	if !h.dirty {
+		h.mu.Unlock()
+		return 0
+	}
+	data := append([]byte(nil), h.data...)
+	h.dirty = false
+	h.mu.Unlock()
+	return h.file.apply(ctx, data)
+}
+
+// applyOutcome is one entry of a .result report.
+type applyOutcome struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Result     string `json:"result"`
+	Error      string `json:"error,omitempty"`
+}
+
+func (o applyOutcome) ref() string {
+	if o.Namespace == "" {
+		return o.Kind + " " + o.Name
+	}
+	return o.Kind + " " + o.Namespace + "/" + o.Name
+}
+
+// applyManifests applies every object of a multi-document YAML stream. Lists
+// are expanded into their items. Nothing is applied when a document cannot
+// be parsed.
+func (k *KubeFS) applyManifests(ctx context.Context, data []byte) ([]applyOutcome, syscall.Errno) {
+	if k.DynamicClient == nil || k.DiscoveryClient == nil {
+		return []applyOutcome{{Result: "failed", Error: "kubefs is not connected to a cluster"}}, syscall.EIO
+	}
+	objects, err := decodeManifests(data)
+	if err != nil {
+		Warnf("Invalid manifest in %s: %v", applyDirName, err)
+		return []applyOutcome{{Result: "invalid", Error: err.Error()}}, syscall.EINVAL
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		return applyRank(objects[i].GetKind()) < applyRank(objects[j].GetKind())
+	})
+
+	outcomes := make([]applyOutcome, 0, len(objects))
+	var first syscall.Errno
+	for _, obj := range objects {
+		outcome, errno := k.applyObject(ctx, obj)
+		outcomes = append(outcomes, outcome)
+		if errno != 0 && first == 0 {
+			first = errno
+		}
+	}
+	return outcomes, first
+}
+
+func decodeManifests(data []byte) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for index := 1; ; index++ {
+		document, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		jsonData, err := yaml.YAMLToJSON(document)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", index, err)
+		}
+		if trimmed := bytes.TrimSpace(jsonData); len(trimmed) == 0 || string(trimmed) == "null" {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(jsonData); err != nil {
+			return nil, fmt.Errorf("document %d: %w", index, err)
+		}
+		if !obj.IsList() {
+			objects = append(objects, obj)
+			continue
+		}
+		err = obj.EachListItem(func(item runtime.Object) error {
+			objects = append(objects, item.(*unstructured.Unstructured))
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", index, err)
+		}
+	}
+	if len(objects) == 0 {
+		return nil, errors.New("no objects found")
+	}
+	return objects, nil
+}
+
+func applyRank(kind string) int {
+	for index, candidate := range applyOrder {
+		if candidate == kind {
+			return index
+		}
+	}
+	return len(applyOrder)
+}
+
+// applyObject creates obj, or server-side applies it when it already
+// exists. Objects go through the same namespace and filter checks as files.
+func (k *KubeFS) applyObject(ctx context.Context, obj *unstructured.Unstructured) (applyOutcome, syscall.Errno) {
+	outcome := applyOutcome{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+	}
+	fail := func(result string, errno syscall.Errno, format string, args ...interface{}) (applyOutcome, syscall.Errno) {
+		outcome.Result = result
+		outcome.Error = fmt.Sprintf(format, args...)
+		Warnf("Apply of %s %s: %s", outcome.ref(), result, outcome.Error)
+		return outcome, errno
+	}
+
+	gvk := obj.GroupVersionKind()
+	if gvk.Kind == "" || gvk.Version == "" {
+		return fail("invalid", syscall.EINVAL, "apiVersion and kind are required")
+	}
+	if obj.GetName() == "" && obj.GetGenerateName() == "" {
+		return fail("invalid", syscall.EINVAL, "metadata.name or metadata.generateName is required")
+	}
+	gvr, resource, err := k.resolveAPIResource(gvk.Group, gvk.Version, gvk.Kind)
+	if err != nil {
+		return fail("invalid", syscall.EINVAL, "cannot resolve %s: %v", gvk, err)
+	}
+
+	if resource.Namespaced {
+		if obj.GetNamespace() == "" {
+			return fail("invalid", syscall.EINVAL, "metadata.namespace is required")
+		}
+		if !k.AllowsNamespace(obj.GetNamespace()) {
+			return fail("denied", syscall.EPERM, "namespace %s is not mounted", obj.GetNamespace())
+		}
+	} else {
+		obj.SetNamespace("")
+		outcome.Namespace = ""
+	}
+	if !k.allowsType(gvr, resource.Kind, !resource.Namespaced) || !k.AllowsObject(gvr, resource.Kind, obj) {
+		return fail("denied", syscall.EPERM, "blocked by filters")
+	}
+	unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+
+	client := k.DynamicClient.Resource(gvr)
+	var target = client.Namespace(obj.GetNamespace())
+	if !resource.Namespaced {
+		target = client
+	}
+
+	var existing *unstructured.Unstructured
+	if obj.GetName() != "" {
+		existing, err = target.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			existing = nil
+		case err != nil:
+			return fail("failed", apiErrno(err), "%v", err)
+		}
+	}
+
+	if existing != nil {
+		body, err := obj.MarshalJSON()
+		if err != nil {
+			return fail("invalid", syscall.EINVAL, "%v", err)
+		}
+		// Fields owned by other managers are only taken over when
+		// applyForceConflicts is set; otherwise the conflict is reported.
+		force := k.GetConfig().ApplyForceConflicts
+		options := metav1.PatchOptions{FieldManager: fieldManager, Force: &force}
+		patched, err := target.Patch(ctx, obj.GetName(), types.ApplyPatchType, body, options)
+		if apierrors.IsConflict(err) {
+			return fail("conflict", syscall.ESTALE, "%v (set applyForceConflicts to take over these fields)", err)
+		}
+		if err != nil {
+			return fail("failed", apiErrno(err), "%v", err)
+		}
+		k.auditMutation(ctx, "patch", gvr, obj.GetNamespace(), obj.GetName(), existing, patched)
+		outcome.Result = "configured"
+	} else {
+		if !k.GetConfig().AllowCreate {
+			return fail("denied", syscall.EPERM, "creating objects requires allowCreate")
+		}
+		if gvr == namespacesGVR && !k.GetConfig().AllowNamespaceLifecycle {
+			return fail("denied", syscall.EPERM, "creating namespaces requires allowNamespaceLifecycle")
+		}
+		obj.SetResourceVersion("")
+		created, err := target.Create(ctx, obj, metav1.CreateOptions{FieldManager: fieldManager})
+		if err != nil {
+			return fail("failed", apiErrno(err), "%v", err)
+		}
+		k.auditMutation(ctx, "create", gvr, obj.GetNamespace(), created.GetName(), nil, created)
+		outcome.Name = created.GetName()
+		outcome.Result = "created"
+	}
+
+	Infof("Applied %s from %s (%s)", outcome.ref(), applyDirName, outcome.Result)
+	if gvr.Group == "apiextensions.k8s.io" && gvr.Resource == "customresourcedefinitions" {
+		if err := k.waitForCRD(ctx, target, outcome.Name); err != nil {
+			outcome.Error = fmt.Sprintf("not established: %v", err)
+			Warnf("CustomResourceDefinition %s is not established, its custom resources may fail to apply: %v", outcome.Name, err)
+		}
+		k.requestDiscovery()
+	}
+	return outcome, 0
+}
+
+// waitForCRD waits until the CustomResourceDefinition name is established
+// and discovery serves its kind, so that custom resources later in the same
+// stream resolve.
+func (k *KubeFS) waitForCRD(ctx context.Context, client dynamic.ResourceInterface, name string) error {
+	return wait.PollUntilContextTimeout(ctx, crdPollInterval, crdEstablishTimeout, true, func(ctx context.Context) (bool, error) {
+		crd, err := client.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if !crdEstablished(crd) {
+			return false, nil
+		}
+		if cached, ok := k.DiscoveryClient.(discovery.CachedDiscoveryInterface); ok {
+			cached.Invalidate()
+		}
+		return k.servesCRD(crd), nil
+	})
+}
+
+func crdEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, condition := range conditions {
+		fields, ok := condition.(map[string]interface{})
+		if ok && fields["type"] == "Established" && fields["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// servesCRD reports whether discovery lists the kind of crd in every version
+// it serves.
+func (k *KubeFS) servesCRD(crd *unstructured.Unstructured) bool {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	var served []string
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, version := range versions {
+		fields, ok := version.(map[string]interface{})
+		if ok && fields["served"] == true {
+			if name, ok := fields["name"].(string); ok {
+				served = append(served, name)
+			}
+		}
+	}
+	if version, _, _ := unstructured.NestedString(crd.Object, "spec", "version"); version != "" && len(versions) == 0 {
+		served = append(served, version)
+	}
+	for _, version := range served {
+		resourceList, err := k.DiscoveryClient.ServerResourcesForGroupVersion(group + "/" + version)
+		if err != nil {
+			return false
+		}
+		found := false
+		for _, resource := range resourceList.APIResources {
+			if resource.Kind == kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,309 @@
+package kubefs
+
+import (
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func newApplyFixture(t *testing.T, cfg Config) (*applyDir, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	kfs := newTestKubeFS(t, cfg)
+	kfs.DynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{configMapsGVR: "ConfigMapList", namespacesGVR: "NamespaceList"},
+		newConfigMap("dev", "settings"))
+	kfs.DiscoveryClient = newCoreDiscovery()
+	client := kfs.DynamicClient.(*dynamicfake.FakeDynamicClient)
+	// The fake tracker cannot server-side apply unstructured objects, so
+	// apply patches replace the stored object.
+	client.PrependReactor("patch", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		patch := action.(clienttesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(patch.GetPatch()); err != nil {
+			return true, nil, err
+		}
+		return true, obj, client.Tracker().Update(patch.GetResource(), obj, patch.GetNamespace())
+	})
+	return kfs.GetChild(applyDirName).Operations().(*applyDir), client
+}
+
+func newCoreDiscovery() *fakediscovery.FakeDiscovery {
+	return &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "namespaces", Kind: "Namespace"},
+			{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+		},
+	}}}}
+}
+
+func dropManifest(t *testing.T, dir *applyDir, name string, data string) syscall.Errno {
+	t.Helper()
+	var out fuse.EntryOut
+	_, handle, _, errno := dir.Create(context.Background(), name, 0, 0644, &out)
+	if errno != 0 {
+		t.Fatalf("create %s: unexpected errno: %v", name, errno)
+	}
+	if _, errno := handle.(*applyHandle).Write(context.Background(), []byte(data), 0); errno != 0 {
+		t.Fatalf("write %s: unexpected errno: %v", name, errno)
+	}
+	return handle.(*applyHandle).Flush(context.Background())
+}
+
+func readResult(t *testing.T, dir *applyDir, name string) string {
+	t.Helper()
+	child := dir.GetChild(name + resultSuffix)
+	if child == nil {
+		t.Fatalf("expected %s%s to exist", name, resultSuffix)
+	}
+	return string(child.Operations().(*generatedFile).content())
+}
+
+func TestApplyDir_AppliesInDependencyOrder(t *testing.T) {
+	dir, client := newApplyFixture(t, Config{Scope: ScopeCluster, AllowCreate: true, AllowNamespaceLifecycle: true})
+	manifest := `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: web
+    namespace: demo
+  data:
+    key: value
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: demo
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: dev
+data:
+  key: updated
+`
+	if errno := dropManifest(t, dir, "bundle.yaml", manifest); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+
+	var created []string
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "create" {
+			created = append(created, action.GetResource().Resource)
+		}
+	}
+	if strings.Join(created, ",") != "namespaces,configmaps" {
+		t.Fatalf("expected namespace to be created first, got %v", created)
+	}
+	if _, err := client.Resource(configMapsGVR).Namespace("demo").Get(context.Background(), "web", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected list item to be created: %v", err)
+	}
+
+	result := readResult(t, dir, "bundle.yaml")
+	for _, expected := range []string{"name: demo\n  result: created", "name: web\n  namespace: demo\n  result: created", "name: settings\n  namespace: dev\n  result: configured"} {
+		if !strings.Contains(result, expected) {
+			t.Fatalf("expected %q in result:\n%s", expected, result)
+		}
+	}
+}
+
+func TestApplyDir_ChecksScopeAndFilters(t *testing.T) {
+	dir, client := newApplyFixture(t, Config{Scope: ScopeNamespace, Namespaces: []string{"dev"}, AllowCreate: true})
+	manifest := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+  namespace: prod
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: fresh
+  namespace: dev
+`
+	if errno := dropManifest(t, dir, "scoped.yaml", manifest); errno != syscall.EPERM {
+		t.Fatalf("expected EPERM, got %v", errno)
+	}
+	if !strings.Contains(readResult(t, dir, "scoped.yaml"), "result: denied") {
+		t.Fatalf("expected denied outcome in result")
+	}
+	if _, err := client.Resource(configMapsGVR).Namespace("dev").Get(context.Background(), "fresh", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected allowed object to still be applied: %v", err)
+	}
+}
+
+func TestApplyDir_RequiresAllowCreate(t *testing.T) {
+	dir, _ := newApplyFixture(t, Config{Scope: ScopeCluster})
+	manifest := "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: demo\n"
+	if errno := dropManifest(t, dir, "ns.yaml", manifest); errno != syscall.EPERM {
+		t.Fatalf("expected EPERM, got %v", errno)
+	}
+}
+
+func TestApplyDir_NamespacesRequireLifecycle(t *testing.T) {
+	dir, client := newApplyFixture(t, Config{Scope: ScopeCluster, AllowCreate: true})
+	manifest := "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: demo\n"
+	if errno := dropManifest(t, dir, "ns.yaml", manifest); errno != syscall.EPERM {
+		t.Fatalf("expected EPERM, got %v", errno)
+	}
+	if _, err := client.Resource(namespacesGVR).Get(context.Background(), "demo", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the namespace not to be created: %v", err)
+	}
+	if !strings.Contains(readResult(t, dir, "ns.yaml"), "allowNamespaceLifecycle") {
+		t.Fatalf("expected the result to name the missing flag")
+	}
+}
+
+func TestApplyFile_TruncateWithoutHandle(t *testing.T) {
+	dir, _ := newApplyFixture(t, Config{Scope: ScopeCluster, AllowCreate: true})
+	var out fuse.EntryOut
+	inode, _, _, errno := dir.Create(context.Background(), "bundle.yaml", 0, 0644, &out)
+	if errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	var attr fuse.AttrOut
+	in := &fuse.SetAttrIn{SetAttrInCommon: fuse.SetAttrInCommon{Valid: fuse.FATTR_SIZE}}
+	if errno := inode.Operations().(*applyFile).Setattr(context.Background(), nil, in, &attr); errno != syscall.EPERM {
+		t.Fatalf("expected EPERM, got %v", errno)
+	}
+}
+
+func TestApplyDir_InvalidManifestAppliesNothing(t *testing.T) {
+	dir, client := newApplyFixture(t, Config{Scope: ScopeCluster, AllowCreate: true})
+	manifest := "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: demo\n---\nkind: [broken\n"
+	if errno := dropManifest(t, dir, "broken.yaml", manifest); errno != syscall.EINVAL {
+		t.Fatalf("expected EINVAL, got %v", errno)
+	}
+	if len(client.Actions()) != 0 {
+		t.Fatalf("expected no API calls, got %v", client.Actions())
+	}
+	if !strings.Contains(readResult(t, dir, "broken.yaml"), "result: invalid") {
+		t.Fatalf("expected invalid outcome in result")
+	}
+
+	if errno := dir.Unlink(context.Background(), "broken.yaml"); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if dir.GetChild("broken.yaml") != nil || dir.GetChild("broken.yaml"+resultSuffix) != nil {
+		t.Fatalf("expected manifest and result to be removed")
+	}
+}
+
+func TestApplyDir_WaitsForCRDBeforeCustomResources(t *testing.T) {
+	dir, client := newApplyFixture(t, Config{Scope: ScopeCluster, AllowCreate: true})
+	discovery := dir.KubeFS.DiscoveryClient.(*fakediscovery.FakeDiscovery)
+	discovery.Resources = append(discovery.Resources, &metav1.APIResourceList{
+		GroupVersion: "apiextensions.k8s.io/v1",
+		APIResources: []metav1.APIResource{{Name: "customresourcedefinitions", Kind: "CustomResourceDefinition"}},
+	})
+	crdsGVR := schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+	// The CRD becomes established, and its kind discoverable, only on the
+	// second read after it is created, as on a real server.
+	reads := 0
+	client.PrependReactor("get", "customresourcedefinitions", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if reads++; reads < 3 {
+			return false, nil, nil
+		}
+		stored, err := client.Tracker().Get(crdsGVR, "", action.(clienttesting.GetAction).GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		crd := stored.(*unstructured.Unstructured)
+		_ = unstructured.SetNestedSlice(crd.Object, []interface{}{map[string]interface{}{"type": "Established", "status": "True"}}, "status", "conditions")
+		if len(discovery.Resources) == 2 {
+			discovery.Resources = append(discovery.Resources, &metav1.APIResourceList{
+				GroupVersion: "kafka.example.com/v1",
+				APIResources: []metav1.APIResource{{Name: "kafkatopics", Kind: "KafkaTopic", Namespaced: true}},
+			})
+		}
+		return true, crd, nil
+	})
+	manifest := `apiVersion: kafka.example.com/v1
+kind: KafkaTopic
+metadata:
+  name: events
+  namespace: dev
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: kafkatopics.kafka.example.com
+spec:
+  group: kafka.example.com
+  names:
+    kind: KafkaTopic
+    plural: kafkatopics
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+`
+	if errno := dropManifest(t, dir, "crd.yaml", manifest); errno != 0 {
+		t.Fatalf("unexpected errno: %v\n%s", errno, readResult(t, dir, "crd.yaml"))
+	}
+	topics := schema.GroupVersionResource{Group: "kafka.example.com", Version: "v1", Resource: "kafkatopics"}
+	if _, err := client.Resource(topics).Namespace("dev").Get(context.Background(), "events", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected the custom resource to be created: %v", err)
+	}
+	if result := readResult(t, dir, "crd.yaml"); strings.Count(result, "result: created") != 2 {
+		t.Fatalf("expected both objects to be created:\n%s", result)
+	}
+}
+
+func TestApplyDir_ReportsFieldConflicts(t *testing.T) {
+	dir, client := newApplyFixture(t, Config{Scope: ScopeCluster})
+	var forced []bool
+	client.PrependReactor("patch", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		force := action.(clienttesting.PatchActionImpl).GetPatchOptions().Force
+		forced = append(forced, force != nil && *force)
+		if force != nil && *force {
+			return false, nil, nil
+		}
+		return true, nil, apierrors.NewApplyConflict([]metav1.StatusCause{{
+			Type:    metav1.CauseTypeFieldManagerConflict,
+			Message: `conflict with "kubectl-client-side-apply"`,
+			Field:   ".data.key",
+		}}, "Apply failed with 1 conflict")
+	})
+	manifest := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  namespace: dev\ndata:\n  key: updated\n"
+
+	if errno := dropManifest(t, dir, "settings.yaml", manifest); errno != syscall.ESTALE {
+		t.Fatalf("expected ESTALE, got %v", errno)
+	}
+	if result := readResult(t, dir, "settings.yaml"); !strings.Contains(result, "result: conflict") || !strings.Contains(result, "applyForceConflicts") {
+		t.Fatalf("expected the conflict in the result:\n%s", result)
+	}
+	if value := settingsValue(t, client); value != "value" {
+		t.Fatalf("expected the object to be untouched, got %q", value)
+	}
+
+	dir.KubeFS.SetConfig(Config{Scope: ScopeCluster, ApplyForceConflicts: true})
+	if errno := dropManifest(t, dir, "forced.yaml", manifest); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if value := settingsValue(t, client); value != "updated" {
+		t.Fatalf("expected the forced apply to take over the field, got %q", value)
+	}
+	if len(forced) != 2 || forced[0] || !forced[1] {
+		t.Fatalf("expected only the second apply to be forced, got %v", forced)
+	}
+}
@@ -0,0 +1,179 @@
+package kubefs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// auditEntry is one line of the audit log.
+type auditEntry struct {
+	Time                  time.Time `json:"time"`
+	User                  string    `json:"user,omitempty"`
+	UID                   *uint32   `json:"uid,omitempty"`
+	PID                   *uint32   `json:"pid,omitempty"`
+	Process               string    `json:"process,omitempty"`
+	Cluster               string    `json:"cluster,omitempty"`
+	Operation             string    `json:"operation"`
+	Group                 string    `json:"group"`
+	Version               string    `json:"version"`
+	Resource              string    `json:"resource"`
+	Namespace             string    `json:"namespace,omitempty"`
+	Name                  string    `json:"name"`
+	ResourceVersionBefore string    `json:"resourceVersionBefore,omitempty"`
+	ResourceVersionAfter  string    `json:"resourceVersionAfter,omitempty"`
+	Diff                  string    `json:"diff,omitempty"`
+	// Count is the number of reads an entry stands for.
+	Count int `json:"count,omitempty"`
+}
+
+var namespacesGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+func (k *KubeFS) auditing() bool {
+	return k.GetConfig().Audit.Path != ""
+}
+
+// auditMutation records a change made through the mount. before is nil for
+// creates and after is nil for deletes.
+func (k *KubeFS) auditMutation(ctx context.Context, operation string, gvr schema.GroupVersionResource, namespace string, name string, before *unstructured.Unstructured, after *unstructured.Unstructured) {
+	if !k.auditing() {
+		return
+	}
+	entry := auditEntry{
+		Time:      time.Now().UTC(),
+		Cluster:   k.cluster,
+		Operation: operation,
+		Group:     gvr.Group,
+		Version:   gvr.Version,
+		Resource:  gvr.Resource,
+		Namespace: namespace,
+		Name:      name,
+		Diff:      auditDiff(before, after),
+	}
+	entry.User, entry.UID, _ = callerIdentity(ctx)
+	if before != nil {
+		entry.ResourceVersionBefore = before.GetResourceVersion()
+	}
+	if after != nil {
+		entry.ResourceVersionAfter = after.GetResourceVersion()
+	}
+	k.writeAudit(k.GetConfig().Audit.Path, entry)
+}
+
+// audit records a change to the object behind r.
+func (r *Resource) audit(ctx context.Context, operation string, before *unstructured.Unstructured, after *unstructured.Unstructured) {
+	namespace := r.Namespace.Name
+	if r.Namespace.Clusterwide {
+		namespace = ""
+	}
+	name := r.Name
+	if after != nil && after.GetName() != "" {
+		name = after.GetName()
+	}
+	r.KubeFS.auditMutation(ctx, operation, r.GroupVersionResource, namespace, name, before, after)
+}
+
+// writeAudit appends an entry to the log at path. Logs are opened on first
+// use and closed once the config no longer names them.
+func (k *KubeFS) writeAudit(path string, entry auditEntry) {
+	if path == "" {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		Errorf("Failed to encode audit entry: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	cfg := k.GetConfig().Audit
+	k.auditMu.Lock()
+	defer k.auditMu.Unlock()
+	for open, file := range k.auditFiles {
+		if open != cfg.Path && open != cfg.Reads.Path {
+			_ = file.Close()
+			delete(k.auditFiles, open)
+		}
+	}
+	file, ok := k.auditFiles[path]
+	if !ok {
+		file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			Errorf("Failed to open audit log %s: %v", path, err)
+			return
+		}
+		if k.auditFiles == nil {
+			k.auditFiles = make(map[string]*os.File)
+		}
+		k.auditFiles[path] = file
+	}
+	if _, err := file.Write(line); err != nil {
+		Errorf("Failed to write audit log %s: %v", path, err)
+	}
+}
+
+// callerIdentity returns the local user behind a FUSE request, by name when
+// it can be looked up, and the calling process.
+func callerIdentity(ctx context.Context) (string, *uint32, *uint32) {
+	caller, ok := fuse.FromContext(ctx)
+	if !ok || caller == nil {
+		return "", nil, nil
+	}
+	uid, pid := caller.Uid, caller.Pid
+	name := strconv.FormatUint(uint64(uid), 10)
+	if account, err := user.LookupId(name); err == nil {
+		name = account.Username
+	}
+	return name, &uid, &pid
+}
+
+// auditDiff is a unified diff of the YAML of two versions of an object,
+// leaving out managedFields and the resourceVersion, which are recorded
+// separately.
+func auditDiff(before *unstructured.Unstructured, after *unstructured.Unstructured) string {
+	diff := difflib.UnifiedDiff{
+		A:        difflib.SplitLines(auditYAML(before)),
+		B:        difflib.SplitLines(auditYAML(after)),
+		FromFile: "before",
+		ToFile:   "after",
+		Context:  3,
+	}
+	text, err := difflib.GetUnifiedDiffString(diff)
+	if err != nil {
+		return ""
+	}
+	return text
+}
+
+func auditYAML(obj *unstructured.Unstructured) string {
+	if obj == nil {
+		return ""
+	}
+	clean := obj.DeepCopy()
+	unstructured.RemoveNestedField(clean.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(clean.Object, "metadata", "resourceVersion")
+	data, err := yaml.Marshal(clean.Object)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// toUnstructured converts a typed object for the audit log.
+func toUnstructured(obj runtime.Object) *unstructured.Unstructured {
+	fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil
+	}
+	return &unstructured.Unstructured{Object: fields}
+}
@@ -0,0 +1,140 @@
+package kubefs
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// readAuditor coalesces repeated reads of an object by one process: the
+// first read is logged right away, and the reads that follow within the
+// window are logged as one entry with their count when it closes.
+type readAuditor struct {
+	mu      sync.Mutex
+	windows map[readKey]*readWindow
+}
+
+type readKey struct {
+	pid       uint32
+	uid       uint32
+	gvr       schema.GroupVersionResource
+	namespace string
+	name      string
+}
+
+type readWindow struct {
+	entry   auditEntry
+	repeats int
+}
+
+// auditsReads reports whether reads of gvr are audited.
+func (k *KubeFS) auditsReads(gvr schema.GroupVersionResource) bool {
+	cfg := k.GetConfig().Audit
+	if cfg.Reads.Path == "" && cfg.Path == "" {
+		return false
+	}
+	key := templateKey(gvr)
+	for _, resource := range cfg.Reads.Resources {
+		if resource == "*" || resource == key {
+			return true
+		}
+	}
+	return false
+}
+
+// auditRead records that the file of r was opened for reading.
+func (r *Resource) auditRead(ctx context.Context) {
+	k := r.KubeFS
+	if !k.auditsReads(r.GroupVersionResource) {
+		return
+	}
+	entry := auditEntry{
+		Time:      time.Now().UTC(),
+		Cluster:   k.cluster,
+		Operation: "read",
+		Group:     r.GroupVersionResource.Group,
+		Version:   r.GroupVersionResource.Version,
+		Resource:  r.GroupVersionResource.Resource,
+		Name:      r.Name,
+		Count:     1,
+	}
+	if !r.Namespace.Clusterwide {
+		entry.Namespace = r.Namespace.Name
+	}
+	var uid, pid *uint32
+	entry.User, uid, pid = callerIdentity(ctx)
+	entry.UID, entry.PID = uid, pid
+	key := readKey{gvr: r.GroupVersionResource, namespace: entry.Namespace, name: entry.Name}
+	if pid != nil {
+		key.pid, key.uid = *pid, *uid
+		entry.Process = processName(*pid)
+	}
+
+	cfg := k.GetConfig().Audit.Reads
+	if cfg.Window.Duration <= 0 {
+		k.writeAudit(k.readAuditPath(), entry)
+		return
+	}
+	k.reads.mu.Lock()
+	if window, ok := k.reads.windows[key]; ok {
+		window.repeats++
+		k.reads.mu.Unlock()
+		return
+	}
+	if k.reads.windows == nil {
+		k.reads.windows = make(map[readKey]*readWindow)
+	}
+	k.reads.windows[key] = &readWindow{entry: entry}
+	k.reads.mu.Unlock()
+
+	k.writeAudit(k.readAuditPath(), entry)
+	time.AfterFunc(cfg.Window.Duration, func() { k.closeReadWindow(key) })
+}
+
+// closeReadWindow logs the reads coalesced since the first one, if any.
+func (k *KubeFS) closeReadWindow(key readKey) {
+	k.reads.mu.Lock()
+	window, ok := k.reads.windows[key]
+	delete(k.reads.windows, key)
+	k.reads.mu.Unlock()
+	if !ok || window.repeats == 0 {
+		return
+	}
+	entry := window.entry
+	entry.Time = time.Now().UTC()
+	entry.Count = window.repeats
+	k.writeAudit(k.readAuditPath(), entry)
+}
+
+// readAuditPath is the log read entries go to: audit.reads.path, or the
+// mutation log when it is not set.
+func (k *KubeFS) readAuditPath() string {
+	cfg := k.GetConfig().Audit
+	if cfg.Reads.Path != "" {
+		return cfg.Reads.Path
+	}
+	return cfg.Path
+}
+
+func processName(pid uint32) string {
+	data, err := os.ReadFile("/proc/" + strconv.FormatUint(uint64(pid), 10) + "/comm")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// normalizeResourceKeys lowercases <resource>.<group> keys and drops the
+// core group, as for templates.
+func normalizeResourceKeys(keys []string) []string {
+	result := make([]string, 0, len(keys))
+	for _, key := range normalizeValues(keys) {
+		result = append(result, strings.TrimSuffix(key, ".core"))
+	}
+	return result
+}
@@ -0,0 +1,159 @@
+package kubefs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func readAuditLog(t *testing.T, path string) []auditEntry {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var entries []auditEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry auditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid audit line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAuditLog_RecordsUpdatesAndDeletes(t *testing.T) {
+	kfs, _ := newRenameFixture(t)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	kfs.SetConfig(Config{Scope: ScopeCluster, AllowDelete: true, Audit: AuditConfig{Path: path}})
+	kfs.cluster = "https://cluster.example:6443"
+	ctx := fuse.NewContext(context.Background(), &fuse.Caller{Owner: fuse.Owner{Uid: 4242}, Pid: 7})
+
+	if errno := settingsResource(kfs).applyYAML(ctx, []byte(editedSettings)); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if errno := namespaceNode(kfs, "dev").Unlink(ctx, settingsFile); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+
+	entries := readAuditLog(t, path)
+	if len(entries) != 2 {
+		t.Fatalf("expected two entries, got %+v", entries)
+	}
+	update := entries[0]
+	if update.Operation != "update" || update.Resource != "configmaps" || update.Namespace != "dev" || update.Name != "settings" ||
+		update.Cluster != kfs.cluster || update.UID == nil || *update.UID != 4242 || update.ResourceVersionBefore != "42" {
+		t.Fatalf("unexpected update entry %+v", update)
+	}
+	if !strings.Contains(update.Diff, "-  key: value") || !strings.Contains(update.Diff, "+  key: edited") {
+		t.Fatalf("expected the change in the diff, got %q", update.Diff)
+	}
+	if entries[1].Operation != "delete" || entries[1].Name != "settings" || !strings.Contains(entries[1].Diff, "-  key: edited") {
+		t.Fatalf("unexpected delete entry %+v", entries[1])
+	}
+}
+
+func TestAuditLog_Disabled(t *testing.T) {
+	kfs, _ := newRenameFixture(t)
+	if kfs.auditing() {
+		t.Fatalf("expected the audit log to be off without a path")
+	}
+	if errno := settingsResource(kfs).applyYAML(context.Background(), []byte(editedSettings)); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if len(kfs.auditFiles) != 0 {
+		t.Fatalf("expected no audit log to be opened")
+	}
+}
+
+func TestAuditReads_CoalescesRepeatedReads(t *testing.T) {
+	kfs, _ := newRenameFixture(t)
+	path := filepath.Join(t.TempDir(), "reads.jsonl")
+	kfs.SetConfig(Config{Scope: ScopeCluster, Audit: AuditConfig{Reads: AuditReadsConfig{
+		Resources: []string{"configmaps"},
+		Path:      path,
+		Window:    metav1.Duration{Duration: 50 * time.Millisecond},
+	}}})
+	res := settingsResource(kfs)
+	reader := fuse.NewContext(context.Background(), &fuse.Caller{Owner: fuse.Owner{Uid: 4242}, Pid: uint32(os.Getpid())})
+	other := fuse.NewContext(context.Background(), &fuse.Caller{Owner: fuse.Owner{Uid: 4242}, Pid: 1})
+
+	for _, ctx := range []context.Context{reader, reader, reader, other} {
+		if _, _, errno := res.Open(ctx, syscall.O_RDONLY); errno != 0 {
+			t.Fatalf("unexpected errno: %v", errno)
+		}
+	}
+	if entries := readAuditLog(t, path); len(entries) != 2 {
+		t.Fatalf("expected the first read of each process, got %+v", entries)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	entries := readAuditLog(t, path)
+	if len(entries) != 3 {
+		t.Fatalf("expected the repeated reads to be logged once, got %+v", entries)
+	}
+	first, coalesced := entries[0], entries[2]
+	if first.Operation != "read" || first.Name != "settings" || first.Count != 1 || first.PID == nil || *first.PID != uint32(os.Getpid()) || first.Process == "" {
+		t.Fatalf("unexpected read entry %+v", first)
+	}
+	if coalesced.Count != 2 || *coalesced.PID != *first.PID {
+		t.Fatalf("expected two coalesced reads, got %+v", coalesced)
+	}
+}
+
+func TestAuditReads_OnlyListedResources(t *testing.T) {
+	kfs, _ := newRenameFixture(t)
+	cfg, err := ParseConfig([]byte("audit:\n  path: /tmp/audit.jsonl\n  reads:\n    resources: [Secrets.core, certificates.cert-manager.io]\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kfs.SetConfig(cfg)
+
+	if !kfs.auditsReads(schema.GroupVersionResource{Version: "v1", Resource: "secrets"}) {
+		t.Fatalf("expected secrets to be audited")
+	}
+	if !kfs.auditsReads(schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}) {
+		t.Fatalf("expected certificates to be audited")
+	}
+	if kfs.auditsReads(configMapsGVR) {
+		t.Fatalf("expected configmaps not to be audited")
+	}
+	if cfg.Audit.Reads.Window.Duration != time.Minute {
+		t.Fatalf("expected the default window, got %v", cfg.Audit.Reads.Window.Duration)
+	}
+}
+
+func TestAuditReads_ZeroWindowLogsEveryRead(t *testing.T) {
+	kfs, _ := newRenameFixture(t)
+	path := filepath.Join(t.TempDir(), "reads.jsonl")
+	cfg, err := ParseConfig([]byte("audit:\n  reads:\n    resources: [configmaps]\n    path: " + path + "\n    window: 0s\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kfs.SetConfig(cfg)
+	res := settingsResource(kfs)
+	reader := fuse.NewContext(context.Background(), &fuse.Caller{Owner: fuse.Owner{Uid: 4242}, Pid: 7})
+
+	for i := 0; i < 3; i++ {
+		if _, _, errno := res.Open(reader, syscall.O_RDONLY); errno != 0 {
+			t.Fatalf("unexpected errno: %v", errno)
+		}
+	}
+	entries := readAuditLog(t, path)
+	if len(entries) != 3 || entries[2].Count != 1 {
+		t.Fatalf("expected every read to be logged, got %+v", entries)
+	}
+	if len(kfs.reads.windows) != 0 {
+		t.Fatalf("expected no coalescing windows to be kept")
+	}
+}
@@ -3,21 +3,127 @@ package kubefs
 import (
 	"bytes"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/yaml"
 )
 
 type Config struct {
-	LogLevel          string       `yaml:"logLevel" json:"logLevel"`
-	Scope             string       `yaml:"scope" json:"scope"`
-	Namespaces        []string     `yaml:"namespaces" json:"namespaces"`
-	AllowRules        []FilterRule `yaml:"allow" json:"allow"`
-	DenyRules         []FilterRule `yaml:"deny" json:"deny"`
-	AllowCreate       bool         `yaml:"allowCreate" json:"allowCreate"`
-	AllowDelete       bool         `yaml:"allowDelete" json:"allowDelete"`
-	ShowManagedFields bool         `yaml:"showManagedFields" json:"showManagedFields"`
+	LogLevel                string            `yaml:"logLevel" json:"logLevel"`
+	Scope                   string            `yaml:"scope" json:"scope"`
+	Namespaces              []string          `yaml:"namespaces" json:"namespaces"`
+	NamespaceSelector       string            `yaml:"namespaceSelector" json:"namespaceSelector"`
+	AllowRules              []FilterRule      `yaml:"allow" json:"allow"`
+	DenyRules               []FilterRule      `yaml:"deny" json:"deny"`
+	ClusterResources        []FilterRule      `yaml:"clusterResources" json:"clusterResources"`
+	AllowCreate             bool              `yaml:"allowCreate" json:"allowCreate"`
+	AllowDelete             bool              `yaml:"allowDelete" json:"allowDelete"`
+	AllowNamespaceLifecycle bool              `yaml:"allowNamespaceLifecycle" json:"allowNamespaceLifecycle"`
+	ForceNamespaceDelete    bool              `yaml:"forceNamespaceDelete" json:"forceNamespaceDelete"`
+	ApplyForceConflicts     bool              `yaml:"applyForceConflicts" json:"applyForceConflicts"`
+	ShowManagedFields       bool              `yaml:"showManagedFields" json:"showManagedFields"`
+	Render                  RenderConfig      `yaml:"render" json:"render"`
+	Delete                  DeleteConfig      `yaml:"delete" json:"delete"`
+	PodDeleteMode           string            `yaml:"podDeleteMode" json:"podDeleteMode"`
+	ReplaceOnImmutable      ReplaceConfig     `yaml:"replaceOnImmutable" json:"replaceOnImmutable"`
+	Audit                   AuditConfig       `yaml:"audit" json:"audit"`
+	HideOwned               bool              `yaml:"hideOwned" json:"hideOwned"`
+	HideOwnedExcept         []string          `yaml:"hideOwnedExcept" json:"hideOwnedExcept"`
+	Templates               map[string]string `yaml:"templates" json:"templates"`
+	MetadataOnly            bool              `yaml:"metadataOnly" json:"metadataOnly"`
+	Lazy                    LazyConfig        `yaml:"lazy" json:"lazy"`
+	Startup                 StartupConfig     `yaml:"startup" json:"startup"`
+	Discovery               DiscoveryConfig   `yaml:"discovery" json:"discovery"`
+}
+
+// DiscoveryConfig controls how often API discovery is re-run to pick up
+// aggregated APIs added or removed after startup (0 disables the refresh).
+type DiscoveryConfig struct {
+	RefreshInterval metav1.Duration `yaml:"refreshInterval" json:"refreshInterval"`
+}
+
+// StartupConfig controls how informers are started. Workers bounds how many
+// informers sync concurrently and SyncTimeout gives up on a single GVR that
+// does not sync in time (0 waits forever).
+type StartupConfig struct {
+	Workers     int             `yaml:"workers" json:"workers"`
+	SyncTimeout metav1.Duration `yaml:"syncTimeout" json:"syncTimeout"`
+}
+
+// RenderConfig lists fields left out of the YAML shown in files, such as
+// status or server-set metadata. HideDefaults also hides fields that no
+// field manager set, i.e. defaults filled in by the API server. Kinds
+// overrides these settings per kind. Hidden fields are restored from the
+// live object when a file is saved.
+type RenderConfig struct {
+	HideFields   []string                    `yaml:"hideFields" json:"hideFields"`
+	HideDefaults bool                        `yaml:"hideDefaults" json:"hideDefaults"`
+	Kinds        map[string]KindRenderConfig `yaml:"kinds" json:"kinds"`
+}
+
+// KindRenderConfig overrides RenderConfig for one kind. Unset fields inherit
+// the defaults; an empty hideFields list shows every field.
+type KindRenderConfig struct {
+	HideFields   []string `yaml:"hideFields" json:"hideFields"`
+	HideDefaults *bool    `yaml:"hideDefaults" json:"hideDefaults"`
+}
+
+// DeleteConfig sets the options sent when a file is removed: the
+// propagation policy for dependents, the grace period, and which of the
+// uid and resourceVersion read through the file must still match. Kinds
+// overrides these settings per kind.
+type DeleteConfig struct {
+	PropagationPolicy  string                      `yaml:"propagationPolicy" json:"propagationPolicy"`
+	GracePeriodSeconds *int64                      `yaml:"gracePeriodSeconds" json:"gracePeriodSeconds"`
+	Preconditions      []string                    `yaml:"preconditions" json:"preconditions"`
+	Kinds              map[string]KindDeleteConfig `yaml:"kinds" json:"kinds"`
+}
+
+// KindDeleteConfig overrides DeleteConfig for one kind. Unset fields inherit
+// the defaults; an empty preconditions list turns preconditions off.
+type KindDeleteConfig struct {
+	PropagationPolicy  string   `yaml:"propagationPolicy" json:"propagationPolicy"`
+	GracePeriodSeconds *int64   `yaml:"gracePeriodSeconds" json:"gracePeriodSeconds"`
+	Preconditions      []string `yaml:"preconditions" json:"preconditions"`
+}
+
+// ReplaceConfig lists the kinds that are deleted and created again when a
+// saved file changes immutable fields. The live manifest is kept in
+// BackupDir first, and Timeout bounds the wait for the old object to go.
+type ReplaceConfig struct {
+	Kinds     []string        `yaml:"kinds" json:"kinds"`
+	BackupDir string          `yaml:"backupDir" json:"backupDir"`
+	Timeout   metav1.Duration `yaml:"timeout" json:"timeout"`
+}
+
+// AuditConfig sets the JSON-lines file every change made through the mount
+// is appended to. An empty path disables the audit log.
+type AuditConfig struct {
+	Path  string           `yaml:"path" json:"path"`
+	Reads AuditReadsConfig `yaml:"reads" json:"reads"`
+}
+
+// AuditReadsConfig lists resources, as <resource>.<group> (<resource> for
+// core), whose files are audited when they are opened for reading. Entries
+// go to Path, or the mutation log when it is empty. Repeated reads of an
+// object by one process within Window are logged as one entry; a zero
+// Window logs every read.
+type AuditReadsConfig struct {
+	Resources []string        `yaml:"resources" json:"resources"`
+	Path      string          `yaml:"path" json:"path"`
+	Window    metav1.Duration `yaml:"window" json:"window"`
+}
+
+// LazyConfig controls on-demand informers. When enabled, informers are only
+// started the first time a directory or file needing them is accessed, and
+// are stopped again once they have been idle for IdleTimeout.
+type LazyConfig struct {
+	Enabled     bool            `yaml:"enabled" json:"enabled"`
+	IdleTimeout metav1.Duration `yaml:"idleTimeout" json:"idleTimeout"`
 }
 
 const (
@@ -25,13 +131,40 @@ const (
 	ScopeNamespace = "namespace"
 )
 
+const (
+	defaultLazyIdleTimeout = 10 * time.Minute
+	defaultStartupWorkers  = 8
+	defaultSyncTimeout     = time.Minute
+	defaultRefreshInterval = 5 * time.Minute
+	defaultReplaceTimeout  = time.Minute
+	defaultReadAuditWindow = time.Minute
+)
+
 func DefaultConfig() Config {
 	return Config{
 		LogLevel:          "info",
 		Scope:             ScopeCluster,
 		AllowCreate:       false,
 		AllowDelete:       false,
+		PodDeleteMode:     PodDeleteModeDelete,
 		ShowManagedFields: false,
+		ReplaceOnImmutable: ReplaceConfig{
+			Timeout: metav1.Duration{Duration: defaultReplaceTimeout},
+		},
+		Audit: AuditConfig{
+			Reads: AuditReadsConfig{Window: metav1.Duration{Duration: defaultReadAuditWindow}},
+		},
+		Lazy: LazyConfig{
+			Enabled:     false,
+			IdleTimeout: metav1.Duration{Duration: defaultLazyIdleTimeout},
+		},
+		Startup: StartupConfig{
+			Workers:     defaultStartupWorkers,
+			SyncTimeout: metav1.Duration{Duration: defaultSyncTimeout},
+		},
+		Discovery: DiscoveryConfig{
+			RefreshInterval: metav1.Duration{Duration: defaultRefreshInterval},
+		},
 	}
 }
 
@@ -44,7 +177,21 @@ func LoadConfig(path string) (Config, error) {
 		return DefaultConfig(), err
 	}
 
-	return ParseConfig(data)
+	cfg, err := ParseConfig(data)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Templates = resolveTemplatePaths(cfg.Templates, filepath.Dir(path))
+	if dir := cfg.ReplaceOnImmutable.BackupDir; dir != "" && !filepath.IsAbs(dir) {
+		cfg.ReplaceOnImmutable.BackupDir = filepath.Join(filepath.Dir(path), dir)
+	}
+	if audit := cfg.Audit.Path; audit != "" && !filepath.IsAbs(audit) {
+		cfg.Audit.Path = filepath.Join(filepath.Dir(path), audit)
+	}
+	if reads := cfg.Audit.Reads.Path; reads != "" && !filepath.IsAbs(reads) {
+		cfg.Audit.Reads.Path = filepath.Join(filepath.Dir(path), reads)
+	}
+	return cfg, nil
 }
 
 func ParseConfig(data []byte) (Config, error) {
@@ -60,6 +207,22 @@ func ParseConfig(data []byte) (Config, error) {
 
 	cfg = normalizeConfig(cfg)
 
+	if _, err := newNamespaceMatcher(cfg); err != nil {
+		return cfg, err
+	}
+	if _, err := newFilterSet(cfg); err != nil {
+		return cfg, err
+	}
+	if err := validateRender(cfg.Render); err != nil {
+		return cfg, err
+	}
+	if err := validateDelete(cfg.Delete); err != nil {
+		return cfg, err
+	}
+	if err := validatePodDeleteMode(cfg.PodDeleteMode); err != nil {
+		return cfg, err
+	}
+
 	return cfg, nil
 }
 
@@ -77,12 +240,71 @@ func normalizeConfig(cfg Config) Config {
 	cfg.Scope = scope
 
 	cfg.Namespaces = normalizeNamespaces(cfg.Namespaces)
+	cfg.NamespaceSelector = strings.TrimSpace(cfg.NamespaceSelector)
 	cfg.AllowRules = normalizeRules(cfg.AllowRules)
 	cfg.DenyRules = normalizeRules(cfg.DenyRules)
+	cfg.ClusterResources = normalizeRules(cfg.ClusterResources)
+	cfg.HideOwnedExcept = normalizeValues(cfg.HideOwnedExcept)
+	cfg.Templates = normalizeTemplates(cfg.Templates)
+	cfg.Delete = normalizeDelete(cfg.Delete)
+	cfg.PodDeleteMode = normalizePodDeleteMode(cfg.PodDeleteMode)
+	cfg.ReplaceOnImmutable.Kinds = normalizeValues(cfg.ReplaceOnImmutable.Kinds)
+	cfg.ReplaceOnImmutable.BackupDir = strings.TrimSpace(cfg.ReplaceOnImmutable.BackupDir)
+	cfg.Audit.Path = strings.TrimSpace(cfg.Audit.Path)
+	cfg.Audit.Reads.Path = strings.TrimSpace(cfg.Audit.Reads.Path)
+	cfg.Audit.Reads.Resources = normalizeResourceKeys(cfg.Audit.Reads.Resources)
+
+	if cfg.Lazy.IdleTimeout.Duration < 0 {
+		cfg.Lazy.IdleTimeout.Duration = 0
+	}
+	if cfg.Startup.Workers < 1 {
+		cfg.Startup.Workers = defaultCfg.Startup.Workers
+	}
+	if cfg.Startup.SyncTimeout.Duration < 0 {
+		cfg.Startup.SyncTimeout.Duration = 0
+	}
+	if cfg.Discovery.RefreshInterval.Duration < 0 {
+		cfg.Discovery.RefreshInterval.Duration = 0
+	}
+	if cfg.ReplaceOnImmutable.Timeout.Duration <= 0 {
+		cfg.ReplaceOnImmutable.Timeout.Duration = defaultCfg.ReplaceOnImmutable.Timeout.Duration
+	}
+	if cfg.Audit.Reads.Window.Duration < 0 {
+		cfg.Audit.Reads.Window.Duration = 0
+	}
 
 	return cfg
 }
 
+// normalizeTemplates lowercases template keys and drops the core group, so
+// "ConfigMaps.core" and "configmaps" name the same resource.
+func normalizeTemplates(templates map[string]string) map[string]string {
+	if len(templates) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(templates))
+	for key, path := range templates {
+		key = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(key)), ".core")
+		path = strings.TrimSpace(path)
+		if key == "" || path == "" {
+			continue
+		}
+		result[key] = path
+	}
+	return result
+}
+
+// resolveTemplatePaths makes relative template paths relative to the
+// directory of the config file.
+func resolveTemplatePaths(templates map[string]string, dir string) map[string]string {
+	for key, path := range templates {
+		if !filepath.IsAbs(path) {
+			templates[key] = filepath.Join(dir, path)
+		}
+	}
+	return templates
+}
+
 func normalizeRules(rules []FilterRule) []FilterRule {
 	if len(rules) == 0 {
 		return nil
@@ -91,10 +313,16 @@ func normalizeRules(rules []FilterRule) []FilterRule {
 	result := make([]FilterRule, 0, len(rules))
 	for _, rule := range rules {
 		clean := FilterRule{
-			ApiGroups: normalizeGroups(rule.ApiGroups),
-			Resources: normalizeValues(rule.Resources),
+			ApiGroups:     normalizeGroups(rule.ApiGroups),
+			Versions:      normalizeValues(rule.Versions),
+			Resources:     normalizeValues(rule.Resources),
+			Kinds:         normalizeValues(rule.Kinds),
+			Namespaces:    normalizeNamespaces(rule.Namespaces),
+			Names:         normalizePatterns(rule.Names),
+			LabelSelector: strings.TrimSpace(rule.LabelSelector),
+			FieldSelector: strings.TrimSpace(rule.FieldSelector),
 		}
-		if len(clean.ApiGroups) == 0 && len(clean.Resources) == 0 {
+		if clean.empty() {
 			continue
 		}
 		result = append(result, clean)
@@ -149,6 +377,29 @@ func normalizeValues(values []string) []string {
 	return result
 }
 
+// normalizePatterns trims and deduplicates glob patterns, keeping their case
+// since character classes are case-sensitive.
+func normalizePatterns(patterns []string) []string {
+	if len(patterns) == 0 {
+		return nil
+	}
+	seen := make(map[string]struct{}, len(patterns))
+	result := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, exists := seen[pattern]; exists {
+			continue
+		}
+		seen[pattern] = struct{}{}
+		result = append(result, pattern)
+	}
+	sort.Strings(result)
+	return result
+}
+
 func normalizeNamespaces(namespaces []string) []string {
 	if len(namespaces) == 0 {
 		return nil
@@ -157,7 +408,10 @@ func normalizeNamespaces(namespaces []string) []string {
 	seen := make(map[string]struct{}, len(namespaces))
 	result := make([]string, 0, len(namespaces))
 	for _, ns := range namespaces {
-		ns = strings.ToLower(strings.TrimSpace(ns))
+		ns = strings.TrimSpace(ns)
+		if !isRegexpPattern(ns) {
+			ns = strings.ToLower(ns)
+		}
 		if ns == "" {
 			continue
 		}
@@ -1,6 +1,9 @@
 package kubefs
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestParseConfig_Empty(t *testing.T) {
 	cfg, err := ParseConfig(nil)
@@ -72,3 +75,37 @@ func TestParseConfig_NormalizesRulesAndNamespaces(t *testing.T) {
 		t.Fatalf("unexpected deny resources: %v", deny.Resources)
 	}
 }
+
+func TestParseConfig_Lazy(t *testing.T) {
+	cfg, err := ParseConfig([]byte("lazy:\n  enabled: true\n  idleTimeout: 5m\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Lazy.Enabled {
+		t.Fatalf("expected lazy informers to be enabled")
+	}
+	if cfg.Lazy.IdleTimeout.Duration != 5*time.Minute {
+		t.Fatalf("unexpected idle timeout: %v", cfg.Lazy.IdleTimeout.Duration)
+	}
+
+	cfg, err = ParseConfig([]byte("lazy:\n  enabled: true\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Lazy.IdleTimeout.Duration != defaultLazyIdleTimeout {
+		t.Fatalf("expected default idle timeout, got %v", cfg.Lazy.IdleTimeout.Duration)
+	}
+}
+
+func TestParseConfig_StartupDefaults(t *testing.T) {
+	cfg, err := ParseConfig([]byte("startup:\n  workers: 0\n  syncTimeout: 30s\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Startup.Workers != defaultStartupWorkers {
+		t.Fatalf("expected default workers, got %d", cfg.Startup.Workers)
+	}
+	if cfg.Startup.SyncTimeout.Duration != 30*time.Second {
+		t.Fatalf("unexpected sync timeout: %v", cfg.Startup.SyncTimeout.Duration)
+	}
+}
@@ -0,0 +1,372 @@
+package kubefs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Extended attributes set on a file before rm override the delete options
+// from the config for that delete. deletionXattr is read-only and marks an
+// object whose deletion is waiting on finalizers.
+const (
+	propagationPolicyXattr  = "user.kubefs.propagationPolicy"
+	gracePeriodSecondsXattr = "user.kubefs.gracePeriodSeconds"
+	preconditionsXattr      = "user.kubefs.preconditions"
+	deletionXattr           = "user.kubefs.deletion"
+)
+
+const (
+	preconditionUID             = "uid"
+	preconditionResourceVersion = "resourceversion"
+)
+
+// deleteOptions are the delete settings that apply to one object.
+type deleteOptions struct {
+	propagationPolicy  string
+	gracePeriodSeconds *int64
+	preconditions      []string
+}
+
+// deleteOptionsFor resolves the delete settings for kind, applying its
+// per-kind override on top of the defaults.
+func deleteOptionsFor(cfg DeleteConfig, kind string) deleteOptions {
+	options := deleteOptions{
+		propagationPolicy:  cfg.PropagationPolicy,
+		gracePeriodSeconds: cfg.GracePeriodSeconds,
+		preconditions:      cfg.Preconditions,
+	}
+	for name, override := range cfg.Kinds {
+		if !strings.EqualFold(name, kind) {
+			continue
+		}
+		if override.PropagationPolicy != "" {
+			options.propagationPolicy = override.PropagationPolicy
+		}
+		if override.GracePeriodSeconds != nil {
+			options.gracePeriodSeconds = override.GracePeriodSeconds
+		}
+		if override.Preconditions != nil {
+			options.preconditions = override.Preconditions
+		}
+	}
+	return options
+}
+
+func normalizeDelete(cfg DeleteConfig) DeleteConfig {
+	cfg.PropagationPolicy = normalizePropagationPolicy(cfg.PropagationPolicy)
+	cfg.Preconditions = normalizePreconditions(cfg.Preconditions)
+	for kind, override := range cfg.Kinds {
+		override.PropagationPolicy = normalizePropagationPolicy(override.PropagationPolicy)
+		override.Preconditions = normalizePreconditions(override.Preconditions)
+		cfg.Kinds[kind] = override
+	}
+	return cfg
+}
+
+func normalizePropagationPolicy(policy string) string {
+	policy = strings.TrimSpace(policy)
+	for _, known := range []metav1.DeletionPropagation{metav1.DeletePropagationForeground, metav1.DeletePropagationBackground, metav1.DeletePropagationOrphan} {
+		if strings.EqualFold(policy, string(known)) {
+			return string(known)
+		}
+	}
+	return policy
+}
+
+// normalizePreconditions lowercases the names, keeping an explicitly empty
+// list distinct from an unset one so kinds can turn preconditions off.
+func normalizePreconditions(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value != "" && value != "none" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func validateDelete(cfg DeleteConfig) error {
+	check := func(scope string, policy string, grace *int64, preconditions []string) error {
+		if err := validatePropagationPolicy(policy); err != nil {
+			return fmt.Errorf("invalid %s: %w", scope, err)
+		}
+		if grace != nil && *grace < 0 {
+			return fmt.Errorf("invalid %s: gracePeriodSeconds must not be negative", scope)
+		}
+		if err := validatePreconditions(preconditions); err != nil {
+			return fmt.Errorf("invalid %s: %w", scope, err)
+		}
+		return nil
+	}
+	if err := check("delete", cfg.PropagationPolicy, cfg.GracePeriodSeconds, cfg.Preconditions); err != nil {
+		return err
+	}
+	for kind, override := range cfg.Kinds {
+		if err := check("delete.kinds."+kind, override.PropagationPolicy, override.GracePeriodSeconds, override.Preconditions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validatePropagationPolicy(policy string) error {
+	switch metav1.DeletionPropagation(policy) {
+	case "", metav1.DeletePropagationForeground, metav1.DeletePropagationBackground, metav1.DeletePropagationOrphan:
+		return nil
+	}
+	return fmt.Errorf("propagationPolicy %q is not one of Foreground, Background, Orphan", policy)
+}
+
+func validatePreconditions(preconditions []string) error {
+	for _, precondition := range preconditions {
+		if precondition != preconditionUID && precondition != preconditionResourceVersion {
+			return fmt.Errorf("precondition %q is not one of uid, resourceVersion", precondition)
+		}
+	}
+	return nil
+}
+
+// deleteOptions builds the options for deleting r: the config for its kind,
+// overridden by any extended attributes set on the file. Preconditions use
+// the UID and resourceVersion last read through the file, or the live
+// object if the file was never read.
+func (r *Resource) deleteOptions(ctx context.Context) (metav1.DeleteOptions, syscall.Errno) {
+	options := deleteOptionsFor(r.KubeFS.GetConfig().Delete, r.GroupVersionKind.Kind)
+
+	r.mu.Lock()
+	for name, value := range r.xattrs {
+		switch name {
+		case propagationPolicyXattr:
+			options.propagationPolicy = value
+		case gracePeriodSecondsXattr:
+			seconds, _ := strconv.ParseInt(value, 10, 64)
+			options.gracePeriodSeconds = &seconds
+		case preconditionsXattr:
+			options.preconditions = normalizePreconditions(strings.Split(value, ","))
+		}
+	}
+	uid, resourceVersion := r.seenUID, r.seenResourceVersion
+	r.mu.Unlock()
+
+	result := metav1.DeleteOptions{GracePeriodSeconds: options.gracePeriodSeconds}
+	if options.propagationPolicy != "" {
+		policy := metav1.DeletionPropagation(options.propagationPolicy)
+		result.PropagationPolicy = &policy
+	}
+	if len(options.preconditions) == 0 {
+		return result, 0
+	}
+	if uid == "" {
+		live, err := r.getResource(ctx)
+		if err != nil {
+			Errorf("Failed to fetch %s for delete preconditions: %v", r.logRef(), err)
+			return result, apiErrno(err)
+		}
+		uid, resourceVersion = string(live.GetUID()), live.GetResourceVersion()
+	}
+	result.Preconditions = &metav1.Preconditions{}
+	for _, precondition := range options.preconditions {
+		switch precondition {
+		case preconditionUID:
+			value := types.UID(uid)
+			result.Preconditions.UID = &value
+		case preconditionResourceVersion:
+			value := resourceVersion
+			result.Preconditions.ResourceVersion = &value
+		}
+	}
+	return result, 0
+}
+
+// recordSeen remembers the identity of the object last read through the file,
+// used for delete preconditions.
+func (r *Resource) recordSeen(object metav1.Object) {
+	r.mu.Lock()
+	r.seenUID = string(object.GetUID())
+	r.seenResourceVersion = object.GetResourceVersion()
+	r.mu.Unlock()
+}
+
+func (r *Resource) setDeletion(object metav1.Object) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if object.GetDeletionTimestamp() == nil {
+		r.deletion = ""
+		return
+	}
+	finalizers := append([]string(nil), object.GetFinalizers()...)
+	sort.Strings(finalizers)
+	r.deletion = fmt.Sprintf("pending since %s, finalizers: %s",
+		object.GetDeletionTimestamp().UTC().Format(time.RFC3339), strings.Join(finalizers, ", "))
+}
+
+// markDeletion records on the files of an object whether its deletion is
+// pending, so objects held by finalizers carry a marker.
+func (k *KubeFS) markDeletion(gvk schema.GroupVersionKind, object metav1.Object) {
+	namespace := object.GetNamespace()
+	if namespace == "" {
+		namespace = "clusterwide"
+	}
+	inode := k.GetChild(namespace)
+	if inode == nil {
+		return
+	}
+	ns, ok := inode.Operations().(*Namespace)
+	if !ok {
+		return
+	}
+	filename := (&Resource{Name: object.GetName(), GroupVersionKind: gvk}).Filename()
+	for _, dir := range []*Namespace{ns, ns.allView()} {
+		if dir == nil {
+			continue
+		}
+		if child := dir.GetChild(filename); child != nil {
+			if res, ok := child.Operations().(*Resource); ok {
+				res.setDeletion(object)
+			}
+		}
+	}
+}
+
+var _ = (fs.NodeGetxattrer)((*Resource)(nil))
+var _ = (fs.NodeSetxattrer)((*Resource)(nil))
+var _ = (fs.NodeRemovexattrer)((*Resource)(nil))
+var _ = (fs.NodeListxattrer)((*Resource)(nil))
+
+func (r *Resource) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	r.mu.Lock()
+	value, ok := r.xattrs[attr]
+	if attr == deletionXattr {
+		value, ok = r.deletion, r.deletion != ""
+	}
+	r.mu.Unlock()
+	if !ok {
+		return 0, syscall.ENODATA
+	}
+	return copyXattr(dest, []byte(value))
+}
+
+func (r *Resource) Setxattr(ctx context.Context, attr string, data []byte, flags uint32) syscall.Errno {
+	value := strings.TrimSpace(string(data))
+	switch attr {
+	case propagationPolicyXattr:
+		value = normalizePropagationPolicy(value)
+		if err := validatePropagationPolicy(value); err != nil {
+			Warnf("Rejected %s on %s: %v", attr, r.logRef(), err)
+			return syscall.EINVAL
+		}
+	case gracePeriodSecondsXattr:
+		if seconds, err := strconv.ParseInt(value, 10, 64); err != nil || seconds < 0 {
+			Warnf("Rejected %s on %s: %q is not a number of seconds", attr, r.logRef(), value)
+			return syscall.EINVAL
+		}
+	case preconditionsXattr:
+		if err := validatePreconditions(normalizePreconditions(strings.Split(value, ","))); err != nil {
+			Warnf("Rejected %s on %s: %v", attr, r.logRef(), err)
+			return syscall.EINVAL
+		}
+	case deletionXattr:
+		return syscall.EPERM
+	default:
+		return syscall.ENOTSUP
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.xattrs == nil {
+		r.xattrs = make(map[string]string)
+	}
+	r.xattrs[attr] = value
+	return 0
+}
+
+func (r *Resource) Removexattr(ctx context.Context, attr string) syscall.Errno {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.xattrs[attr]; !ok {
+		return syscall.ENODATA
+	}
+	delete(r.xattrs, attr)
+	return 0
+}
+
+func (r *Resource) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.xattrs)+1)
+	for name := range r.xattrs {
+		names = append(names, name)
+	}
+	if r.deletion != "" {
+		names = append(names, deletionXattr)
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	var list []byte
+	for _, name := range names {
+		list = append(list, name...)
+		list = append(list, 0)
+	}
+	return copyXattr(dest, list)
+}
+
+// pendingDeletion reports whether finalizers still hold r after it was
+// deleted. The file is dropped once rm returns, so it is kept aside and
+// listed again by the next Lookup or Opendir until the informer reports the
+// object gone. It is held before the object is read, so a removal reported
+// meanwhile is not missed.
+func (n *Namespace) pendingDeletion(ctx context.Context, name string, inode *fs.Inode, r *Resource) bool {
+	n.holdPending(name, inode)
+	live, err := r.getResource(ctx)
+	if err != nil || live.GetDeletionTimestamp() == nil || len(live.GetFinalizers()) == 0 {
+		n.dropPending(name)
+		return false
+	}
+	r.setDeletion(live)
+	Infof("Deletion of %s is pending on finalizers %v", r.logRef(), live.GetFinalizers())
+	return true
+}
+
+func (n *Namespace) holdPending(name string, inode *fs.Inode) {
+	n.pendingMu.Lock()
+	defer n.pendingMu.Unlock()
+	if n.pending == nil {
+		n.pending = make(map[string]*fs.Inode)
+	}
+	n.pending[name] = inode
+}
+
+func (n *Namespace) dropPending(name string) {
+	n.pendingMu.Lock()
+	delete(n.pending, name)
+	n.pendingMu.Unlock()
+}
+
+// restorePending lists again the held file called name, or every held file
+// when name is empty.
+func (n *Namespace) restorePending(name string) {
+	n.pendingMu.Lock()
+	defer n.pendingMu.Unlock()
+	for pendingName, inode := range n.pending {
+		if name != "" && pendingName != name {
+			continue
+		}
+		if n.GetChild(pendingName) == nil {
+			n.AddChild(pendingName, inode, false)
+		}
+	}
+}
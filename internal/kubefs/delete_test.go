@@ -0,0 +1,218 @@
+package kubefs
+
+import (
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+const settingsFile = "settings.configmap.core.v1.yaml"
+
+func settingsResource(kfs *KubeFS) *Resource {
+	return namespaceNode(kfs, "dev").GetChild(settingsFile).Operations().(*Resource)
+}
+
+// recordDeletes captures the options of every delete sent to the client.
+func recordDeletes(client *dynamicfake.FakeDynamicClient) *[]metav1.DeleteOptions {
+	var options []metav1.DeleteOptions
+	client.PrependReactor("delete", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		options = append(options, action.(clienttesting.DeleteActionImpl).GetDeleteOptions())
+		return false, nil, nil
+	})
+	return &options
+}
+
+func TestParseConfig_Delete(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+delete:
+  propagationPolicy: foreground
+  gracePeriodSeconds: 30
+  preconditions: [UID]
+  kinds:
+    Pod:
+      gracePeriodSeconds: 0
+      preconditions: []
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	configMap := deleteOptionsFor(cfg.Delete, "ConfigMap")
+	if configMap.propagationPolicy != "Foreground" || *configMap.gracePeriodSeconds != 30 || len(configMap.preconditions) != 1 || configMap.preconditions[0] != preconditionUID {
+		t.Fatalf("expected defaults for configmaps, got %+v", configMap)
+	}
+	pod := deleteOptionsFor(cfg.Delete, "pod")
+	if pod.propagationPolicy != "Foreground" || *pod.gracePeriodSeconds != 0 || len(pod.preconditions) != 0 {
+		t.Fatalf("expected pod override, got %+v", pod)
+	}
+
+	for _, data := range []string{
+		"delete:\n  propagationPolicy: cascade\n",
+		"delete:\n  gracePeriodSeconds: -1\n",
+		"delete:\n  kinds:\n    Pod:\n      preconditions: [generation]\n",
+	} {
+		if _, err := ParseConfig([]byte(data)); err == nil {
+			t.Fatalf("expected %q to be rejected", data)
+		}
+	}
+}
+
+func TestUnlink_SendsDeleteOptions(t *testing.T) {
+	kfs, client := newRenameFixture(t)
+	grace := int64(30)
+	kfs.SetConfig(Config{Scope: ScopeCluster, AllowDelete: true, Delete: DeleteConfig{
+		PropagationPolicy:  "Background",
+		GracePeriodSeconds: &grace,
+		Preconditions:      []string{preconditionUID, preconditionResourceVersion},
+	}})
+	deletes := recordDeletes(client)
+	res := settingsResource(kfs)
+	if _, err := res.fetchYAML(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if errno := res.Setxattr(context.Background(), propagationPolicyXattr, []byte("orphan"), 0); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+
+	if errno := namespaceNode(kfs, "dev").Unlink(context.Background(), settingsFile); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if len(*deletes) != 1 {
+		t.Fatalf("expected one delete, got %d", len(*deletes))
+	}
+	options := (*deletes)[0]
+	if options.PropagationPolicy == nil || *options.PropagationPolicy != metav1.DeletePropagationOrphan {
+		t.Fatalf("expected xattr to override the propagation policy, got %v", options.PropagationPolicy)
+	}
+	if options.GracePeriodSeconds == nil || *options.GracePeriodSeconds != 30 {
+		t.Fatalf("expected grace period from config, got %v", options.GracePeriodSeconds)
+	}
+	if options.Preconditions == nil || *options.Preconditions.UID != "1234" || *options.Preconditions.ResourceVersion != "42" {
+		t.Fatalf("expected preconditions from the object read, got %+v", options.Preconditions)
+	}
+}
+
+func TestUnlink_PreconditionConflict(t *testing.T) {
+	kfs, client := newRenameFixture(t)
+	client.PrependReactor("delete", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewConflict(configMapsGVR.GroupResource(), "settings", nil)
+	})
+
+	if errno := namespaceNode(kfs, "dev").Unlink(context.Background(), settingsFile); errno != syscall.ESTALE {
+		t.Fatalf("expected ESTALE, got %v", errno)
+	}
+}
+
+func TestSetxattr_ValidatesDeleteOverrides(t *testing.T) {
+	kfs, _ := newRenameFixture(t)
+	res := settingsResource(kfs)
+	ctx := context.Background()
+
+	if errno := res.Setxattr(ctx, propagationPolicyXattr, []byte("cascade"), 0); errno != syscall.EINVAL {
+		t.Fatalf("expected EINVAL for an unknown policy, got %v", errno)
+	}
+	if errno := res.Setxattr(ctx, gracePeriodSecondsXattr, []byte("soon"), 0); errno != syscall.EINVAL {
+		t.Fatalf("expected EINVAL for a bad grace period, got %v", errno)
+	}
+	if errno := res.Setxattr(ctx, deletionXattr, []byte("x"), 0); errno != syscall.EPERM {
+		t.Fatalf("expected EPERM for the deletion marker, got %v", errno)
+	}
+	if errno := res.Setxattr(ctx, preconditionsXattr, []byte("none"), 0); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+
+	dest := make([]byte, 128)
+	size, errno := res.Listxattr(ctx, dest)
+	if errno != 0 || string(dest[:size]) != preconditionsXattr+"\x00" {
+		t.Fatalf("unexpected xattr list %q (%v)", dest[:size], errno)
+	}
+	if errno := res.Removexattr(ctx, preconditionsXattr); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if _, errno := res.Getxattr(ctx, preconditionsXattr, dest); errno != syscall.ENODATA {
+		t.Fatalf("expected ENODATA after removal, got %v", errno)
+	}
+}
+
+// deleteWith makes deletes of configmaps only set deletionTimestamp and the
+// given finalizers.
+func deleteWith(client *dynamicfake.FakeDynamicClient, finalizers ...string) {
+	client.PrependReactor("delete", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		live, err := client.Tracker().Get(configMapsGVR, "dev", "settings")
+		if err != nil {
+			return true, nil, err
+		}
+		obj := live.DeepCopyObject().(metav1.Object)
+		now := metav1.NewTime(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+		obj.SetDeletionTimestamp(&now)
+		obj.SetFinalizers(finalizers)
+		return true, nil, client.Tracker().Update(configMapsGVR, obj.(runtime.Object), "dev")
+	})
+}
+
+// unlink removes name like the go-fuse bridge does: the node's Unlink, then
+// the child entry once it succeeds.
+func unlink(t *testing.T, dir *Namespace, name string) {
+	t.Helper()
+	if errno := dir.Unlink(context.Background(), name); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	dir.RmChild(name)
+}
+
+func TestUnlink_KeepsObjectPendingOnFinalizers(t *testing.T) {
+	kfs, client := newRenameFixture(t)
+	deleteWith(client, "example.com/cleanup")
+	dev := namespaceNode(kfs, "dev")
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+
+	unlink(t, dev, settingsFile)
+
+	var out fuse.EntryOut
+	child, errno := dev.Lookup(context.Background(), settingsFile, &out)
+	if errno != 0 {
+		t.Fatalf("expected the file to be shown while finalizers hold the object, got %v", errno)
+	}
+	dest := make([]byte, 128)
+	size, errno := child.Operations().(*Resource).Getxattr(context.Background(), deletionXattr, dest)
+	if errno != 0 || !strings.Contains(string(dest[:size]), "2026-01-02T03:04:05Z") || !strings.Contains(string(dest[:size]), "example.com/cleanup") {
+		t.Fatalf("unexpected deletion marker %q (%v)", dest[:size], errno)
+	}
+	dev.RmChild(settingsFile)
+	if errno := dev.Opendir(context.Background()); errno != 0 || dev.GetChild(settingsFile) == nil {
+		t.Fatalf("expected the file to be listed again, got %v", errno)
+	}
+
+	kfs.markDeletion(gvk, newConfigMap("dev", "settings"))
+	if _, errno := child.Operations().(*Resource).Getxattr(context.Background(), deletionXattr, dest); errno != syscall.ENODATA {
+		t.Fatalf("expected marker to clear, got %v", errno)
+	}
+
+	kfs.DeleteResource(context.Background(), "settings", "configmaps", "dev", gvk)
+	if _, errno := dev.Lookup(context.Background(), settingsFile, &out); errno != syscall.ENOENT {
+		t.Fatalf("expected the file to go with the object, got %v", errno)
+	}
+}
+
+func TestUnlink_GracefulDeletionIsNotPending(t *testing.T) {
+	kfs, client := newRenameFixture(t)
+	deleteWith(client)
+	dev := namespaceNode(kfs, "dev")
+
+	unlink(t, dev, settingsFile)
+
+	var out fuse.EntryOut
+	if _, errno := dev.Lookup(context.Background(), settingsFile, &out); errno != syscall.ENOENT {
+		t.Fatalf("expected the file to stay removed without finalizers, got %v", errno)
+	}
+}
@@ -0,0 +1,160 @@
+package kubefs
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+var apiServicesGVR = schema.GroupVersionResource{Group: "apiregistration.k8s.io", Version: "v1", Resource: "apiservices"}
+
+// discoverResources diffs the server's preferred resources against the
+// informers started by earlier discoveries, starting new ones and stopping
+// those whose API is gone.
+func discoverResources(discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface, kubefs *KubeFS) {
+	resourceLists, err := discoveryClient.ServerPreferredResources()
+	failedGroups := make(map[schema.GroupVersion]bool)
+	if err != nil {
+		Errorf("Error discovering resources: %v", err)
+		var groupErr *discovery.ErrGroupDiscoveryFailed
+		if !errors.As(err, &groupErr) {
+			return
+		}
+		for groupVersion := range groupErr.Groups {
+			failedGroups[groupVersion] = true
+		}
+	}
+	kubefs.setPreferredResources(resourceLists, failedGroups)
+
+	namespaceList := kubefs.AllowedNamespaces()
+	if !kubefs.IsClusterScope() && len(namespaceList) == 0 {
+		if kubefs.UsesNamespaceInformer() {
+			Debugf("No namespaces match the namespace selection yet; only cluster resources are watched")
+		} else {
+			Warnf("Namespace scope enabled but no namespaces configured; only cluster resources are watched")
+		}
+	}
+
+	var targets []informerTarget
+	for _, resourceList := range resourceLists {
+		groupVersion, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			Errorf("Failed to parse GroupVersion %q: %v", resourceList.GroupVersion, err)
+			continue
+		}
+
+		for _, resource := range resourceList.APIResources {
+			if !supportsListAndWatch(resource.Verbs) {
+				continue
+			}
+
+			// Skip subresources
+			if strings.Contains(resource.Name, "/") {
+				continue
+			}
+
+			gvr := schema.GroupVersionResource{
+				Group:    groupVersion.Group,
+				Version:  groupVersion.Version,
+				Resource: resource.Name,
+			}
+			if !kubefs.allowsType(gvr, resource.Kind, !resource.Namespaced) {
+				continue
+			}
+
+			if kubefs.IsClusterScope() || !resource.Namespaced {
+				targets = append(targets, informerTarget{
+					key:        informerKey{gvr: gvr, namespace: metav1.NamespaceAll},
+					kind:       resource.Kind,
+					namespaced: resource.Namespaced,
+				})
+				continue
+			}
+
+			for _, ns := range namespaceList {
+				targets = append(targets, informerTarget{
+					key:        informerKey{gvr: gvr, namespace: ns},
+					kind:       resource.Kind,
+					namespaced: resource.Namespaced,
+				})
+			}
+		}
+	}
+
+	kubefs.informers.reconcileDiscovered(dynamicClient, targets, failedGroups)
+}
+
+// runDiscoveryRefresher periodically re-runs discovery so aggregated APIs
+// registered or removed after startup are picked up. Changes to APIService
+// objects and newly selected namespaces trigger an immediate refresh.
+func runDiscoveryRefresher(dynamicClient dynamic.Interface, kubefs *KubeFS) {
+	trigger := kubefs.discoveryTrigger
+	watchAPIServices(dynamicClient, kubefs)
+
+	for {
+		interval := kubefs.GetConfig().Discovery.RefreshInterval.Duration
+		wait := interval
+		if wait <= 0 {
+			// Refresh is disabled; only wake up to notice a config change.
+			wait = time.Minute
+		}
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-kubefs.informers.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			if interval <= 0 {
+				continue
+			}
+			Debugf("Refreshing API discovery")
+		case <-trigger:
+			timer.Stop()
+			Debugf("Refresh requested; refreshing API discovery")
+		}
+		discoverResources(kubefs.DiscoveryClient, dynamicClient, kubefs)
+	}
+}
+
+// requestDiscovery asks the refresher to re-run discovery as soon as
+// possible. Requests made while one is pending are coalesced.
+func (k *KubeFS) requestDiscovery() {
+	select {
+	case k.discoveryTrigger <- struct{}{}:
+	default:
+	}
+}
+
+func watchAPIServices(dynamicClient dynamic.Interface, kubefs *KubeFS) {
+	notify := kubefs.requestDiscovery
+
+	informer := dynamicinformer.NewFilteredDynamicInformer(dynamicClient, apiServicesGVR, metav1.NamespaceAll, time.Minute*30, cache.Indexers{}, nil).Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			if !isInInitialList {
+				notify()
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldService, oldOk := oldObj.(*unstructured.Unstructured)
+			newService, newOk := newObj.(*unstructured.Unstructured)
+			if oldOk && newOk && oldService.GetResourceVersion() == newService.GetResourceVersion() {
+				return
+			}
+			notify()
+		},
+		DeleteFunc: func(obj interface{}) {
+			notify()
+		},
+	})
+	go informer.Run(kubefs.informers.Done())
+}
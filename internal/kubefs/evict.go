@@ -0,0 +1,112 @@
+package kubefs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Pod delete modes: evict goes through the pods/eviction subresource so
+// PodDisruptionBudgets are respected.
+const (
+	PodDeleteModeDelete = "delete"
+	PodDeleteModeEvict  = "evict"
+)
+
+var pdbGVR = schema.GroupVersionResource{Group: "policy", Version: "v1", Resource: "poddisruptionbudgets"}
+
+// evicts reports whether removing r evicts a pod instead of deleting it.
+func (r *Resource) evicts() bool {
+	return r.GroupVersionResource.Group == "" && r.GroupVersionResource.Resource == "pods" &&
+		!r.Namespace.Clusterwide && r.KubeFS.GetConfig().PodDeleteMode == PodDeleteModeEvict
+}
+
+// evictPod asks the API server to evict the pod with the given delete
+// options. It fails with 429 Too Many Requests while a disruption budget
+// does not allow it.
+func (r *Resource) evictPod(ctx context.Context, options metav1.DeleteOptions) error {
+	eviction := &unstructured.Unstructured{}
+	eviction.SetAPIVersion("policy/v1")
+	eviction.SetKind("Eviction")
+	eviction.SetName(r.Name)
+	eviction.SetNamespace(r.Namespace.Name)
+	deleteOptions, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&options)
+	if err != nil {
+		return err
+	}
+	eviction.Object["deleteOptions"] = deleteOptions
+
+	_, err = r.KubeFS.resourceInterface(r.GroupVersionResource, r.Namespace).Create(ctx, eviction, metav1.CreateOptions{}, "eviction")
+	return err
+}
+
+// blockingBudgets names the disruption budgets that refused an eviction,
+// from the causes of the error or, failing that, the budgets selecting the
+// pod.
+func (r *Resource) blockingBudgets(ctx context.Context, evictErr error) string {
+	var causes []string
+	if status, ok := evictErr.(apierrors.APIStatus); ok && status.Status().Details != nil {
+		for _, cause := range status.Status().Details.Causes {
+			if cause.Type == "DisruptionBudget" {
+				causes = append(causes, cause.Message)
+			}
+		}
+	}
+	if len(causes) > 0 {
+		return strings.Join(causes, "; ")
+	}
+
+	pod, err := r.getResource(ctx)
+	if err != nil {
+		return "unknown"
+	}
+	budgets, err := r.KubeFS.DynamicClient.Resource(pdbGVR).Namespace(r.Namespace.Name).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		Debugf("Failed to list disruption budgets for %s: %v", r.logRef(), err)
+		return "unknown"
+	}
+	var names []string
+	for _, budget := range budgets.Items {
+		fields, found, _ := unstructured.NestedMap(budget.Object, "spec", "selector")
+		if !found {
+			continue
+		}
+		var labelSelector metav1.LabelSelector
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(fields, &labelSelector); err != nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(&labelSelector)
+		if err != nil || selector.Empty() {
+			continue
+		}
+		if selector.Matches(labels.Set(pod.GetLabels())) {
+			names = append(names, budget.GetName())
+		}
+	}
+	if len(names) == 0 {
+		return "unknown"
+	}
+	return strings.Join(names, ", ")
+}
+
+func validatePodDeleteMode(mode string) error {
+	if mode != PodDeleteModeDelete && mode != PodDeleteModeEvict {
+		return fmt.Errorf("invalid podDeleteMode %q: expected delete or evict", mode)
+	}
+	return nil
+}
+
+func normalizePodDeleteMode(mode string) string {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		return PodDeleteModeDelete
+	}
+	return mode
+}
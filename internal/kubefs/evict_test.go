@@ -0,0 +1,103 @@
+package kubefs
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+const webPodFile = "web-0.pod.core.v1.yaml"
+
+func newEvictFixture(t *testing.T, objects ...runtime.Object) (*Namespace, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	kfs := newTestKubeFS(t, Config{Scope: ScopeCluster, AllowDelete: true, PodDeleteMode: PodDeleteModeEvict})
+	pod := &unstructured.Unstructured{}
+	pod.SetAPIVersion("v1")
+	pod.SetKind("Pod")
+	pod.SetNamespace("dev")
+	pod.SetName("web-0")
+	pod.SetLabels(map[string]string{"app": "web"})
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{podsGVR: "PodList", pdbGVR: "PodDisruptionBudgetList"},
+		append([]runtime.Object{pod}, objects...)...)
+	kfs.DynamicClient = client
+	kfs.AddNamespace(context.Background(), "dev", false)
+	kfs.AddResource(context.Background(), "web-0", "pods", "dev", schema.GroupVersionKind{Version: "v1", Kind: "Pod"})
+	return namespaceNode(kfs, "dev"), client
+}
+
+func disruptionBudget(name string, app string) *unstructured.Unstructured {
+	budget := &unstructured.Unstructured{}
+	budget.SetAPIVersion("policy/v1")
+	budget.SetKind("PodDisruptionBudget")
+	budget.SetNamespace("dev")
+	budget.SetName(name)
+	_ = unstructured.SetNestedStringMap(budget.Object, map[string]string{"app": app}, "spec", "selector", "matchLabels")
+	return budget
+}
+
+func TestUnlink_EvictsPods(t *testing.T) {
+	dev, client := newEvictFixture(t)
+	var evictions []*unstructured.Unstructured
+	client.PrependReactor("create", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		evictions = append(evictions, action.(clienttesting.CreateAction).GetObject().(*unstructured.Unstructured))
+		return true, nil, client.Tracker().Delete(podsGVR, "dev", "web-0")
+	})
+
+	if errno := dev.Unlink(context.Background(), webPodFile); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if len(evictions) != 1 || evictions[0].GetKind() != "Eviction" || evictions[0].GetName() != "web-0" {
+		t.Fatalf("expected one eviction of web-0, got %v", evictions)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "delete" {
+			t.Fatalf("expected no plain delete, got %v", action)
+		}
+	}
+}
+
+func TestUnlink_EvictionBlockedByBudget(t *testing.T) {
+	dev, client := newEvictFixture(t, disruptionBudget("web-pdb", "web"), disruptionBudget("db-pdb", "db"))
+	client.PrependReactor("create", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+	})
+
+	if errno := dev.Unlink(context.Background(), webPodFile); errno != syscall.EBUSY {
+		t.Fatalf("expected EBUSY, got %v", errno)
+	}
+	res := dev.GetChild(webPodFile).Operations().(*Resource)
+	if budgets := res.blockingBudgets(context.Background(), apierrors.NewTooManyRequests("", 0)); budgets != "web-pdb" {
+		t.Fatalf("expected the matching budget, got %q", budgets)
+	}
+
+	refused := apierrors.NewTooManyRequests("", 0)
+	refused.ErrStatus.Details.Causes = []metav1.StatusCause{{Type: "DisruptionBudget", Message: "The disruption budget web-pdb needs 2 healthy pods and has 2 currently"}}
+	if budgets := res.blockingBudgets(context.Background(), refused); budgets != refused.ErrStatus.Details.Causes[0].Message {
+		t.Fatalf("expected the cause from the API server, got %q", budgets)
+	}
+}
+
+func TestParseConfig_PodDeleteMode(t *testing.T) {
+	cfg, err := ParseConfig([]byte("podDeleteMode: Evict\n"))
+	if err != nil || cfg.PodDeleteMode != PodDeleteModeEvict {
+		t.Fatalf("expected evict mode, got %q (%v)", cfg.PodDeleteMode, err)
+	}
+	if cfg, _ := ParseConfig(nil); cfg.PodDeleteMode != PodDeleteModeDelete {
+		t.Fatalf("expected delete by default, got %q", cfg.PodDeleteMode)
+	}
+	if _, err := ParseConfig([]byte("podDeleteMode: drain\n")); err == nil {
+		t.Fatalf("expected unknown mode to be rejected")
+	}
+}
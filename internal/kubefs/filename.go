@@ -2,9 +2,13 @@ package kubefs
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"strings"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
 )
 
 func parseResourceFilename(filename string) (name string, kind string, group string, version string, ok bool) {
@@ -28,10 +32,90 @@ func parseResourceFilename(filename string) (name string, kind string, group str
 	return name, kind, group, version, true
 }
 
+// errUnknownType is returned when a short type matches nothing in discovery.
+var errUnknownType = errors.New("resource type not found")
+
+// parseShortFilename parses the short form <name>.<type>.yaml, where type is
+// a kind, resource name, short name or category, such as web.deploy.yaml.
+func parseShortFilename(filename string) (name string, token string, ok bool) {
+	parts := strings.Split(filename, ".")
+	if len(parts) < 3 || len(parts) >= 5 || parts[len(parts)-1] != "yaml" {
+		return "", "", false
+	}
+	token = strings.ToLower(strings.TrimSpace(parts[len(parts)-2]))
+	name = strings.Join(parts[:len(parts)-2], ".")
+	if name == "" || token == "" {
+		return "", "", false
+	}
+	return name, token, true
+}
+
+// isResourceFilename reports whether filename has the form of a resource
+// filename. A short name is only a resource filename if its type resolves,
+// see resolveFilename.
+func isResourceFilename(filename string) bool {
+	if _, _, _, _, ok := parseResourceFilename(filename); ok {
+		return true
+	}
+	_, _, ok := parseShortFilename(filename)
+	return ok
+}
+
+// resolveFilename resolves a full or short resource filename to the object
+// name, resource and kind. The error wraps errUnknownType when the type of a
+// short filename matches nothing, so the file is an ordinary scratch file.
+func (k *KubeFS) resolveFilename(filename string) (string, schema.GroupVersionResource, string, error) {
+	if name, kind, group, version, ok := parseResourceFilename(filename); ok {
+		gvr, kind, err := k.ResolveResource(group, version, kind)
+		return name, gvr, kind, err
+	}
+	if name, token, ok := parseShortFilename(filename); ok {
+		gvr, kind, err := k.ResolveResource("", "", token)
+		return name, gvr, kind, err
+	}
+	return "", schema.GroupVersionResource{}, "", errors.New("not a resource filename")
+}
+
+// listedName is the name the file is listed under: the short filename it
+// was created with, or its full name.
+func (r *Resource) listedName() string {
+	r.mu.Lock()
+	alias := r.alias
+	r.mu.Unlock()
+	if alias != "" {
+		return alias
+	}
+	return r.Filename()
+}
+
+// settleAlias moves a file created with a short filename to its full name.
+func (r *Resource) settleAlias() {
+	r.mu.Lock()
+	alias := r.alias
+	r.alias = ""
+	r.mu.Unlock()
+	if alias == "" || r.Namespace == nil {
+		return
+	}
+	if child := r.Namespace.GetChild(alias); child != nil && child.Operations() == r {
+		r.Namespace.MvChild(alias, &r.Namespace.Inode, r.Filename(), true)
+	}
+}
+
+// ResolveResource finds the resource for a kind. Without a version, kind may
+// also be a resource name, short name or category, and the preferred version
+// of its group is used.
 func (k *KubeFS) ResolveResource(group string, version string, kind string) (schema.GroupVersionResource, string, error) {
+	gvr, resource, err := k.resolveAPIResource(group, version, kind)
+	return gvr, resource.Kind, err
+}
+
+// resolveAPIResource is ResolveResource returning the full discovery entry,
+// which also tells whether the resource is namespaced.
+func (k *KubeFS) resolveAPIResource(group string, version string, kind string) (schema.GroupVersionResource, metav1.APIResource, error) {
 	var empty schema.GroupVersionResource
 	if k.DiscoveryClient == nil {
-		return empty, "", errors.New("discovery client not configured")
+		return empty, metav1.APIResource{}, errors.New("discovery client not configured")
 	}
 	group = strings.ToLower(strings.TrimSpace(group))
 	version = strings.ToLower(strings.TrimSpace(version))
@@ -40,6 +124,10 @@ func (k *KubeFS) ResolveResource(group string, version string, kind string) (sch
 		group = ""
 	}
 
+	if version == "" {
+		return k.resolveShortName(group, kind)
+	}
+
 	gv := version
 	if group != "" {
 		gv = group + "/" + version
@@ -47,7 +135,7 @@ func (k *KubeFS) ResolveResource(group string, version string, kind string) (sch
 
 	resourceList, err := k.DiscoveryClient.ServerResourcesForGroupVersion(gv)
 	if err != nil {
-		return empty, "", err
+		return empty, metav1.APIResource{}, err
 	}
 
 	for _, resource := range resourceList.APIResources {
@@ -55,9 +143,101 @@ func (k *KubeFS) ResolveResource(group string, version string, kind string) (sch
 			continue
 		}
 		if strings.EqualFold(resource.Kind, kind) {
-			return schema.GroupVersionResource{Group: group, Version: version, Resource: resource.Name}, resource.Kind, nil
+			return schema.GroupVersionResource{Group: group, Version: version, Resource: resource.Name}, resource, nil
+		}
+	}
+
+	return empty, metav1.APIResource{}, errors.New("resource kind not found")
+}
+
+// resolveShortName matches token against the kinds, resource names and short
+// names of the preferred version of every group, then against categories.
+// More than one match is an error listing the candidates.
+func (k *KubeFS) resolveShortName(group string, token string) (schema.GroupVersionResource, metav1.APIResource, error) {
+	var empty schema.GroupVersionResource
+	resourceLists, err := k.preferredResources()
+	if err != nil {
+		return empty, metav1.APIResource{}, err
+	}
+
+	type candidate struct {
+		gvr      schema.GroupVersionResource
+		resource metav1.APIResource
+	}
+	var byName, byCategory []candidate
+	for _, resourceList := range resourceLists {
+		groupVersion, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			continue
+		}
+		if group != "" && groupVersion.Group != group {
+			continue
+		}
+		for _, resource := range resourceList.APIResources {
+			if strings.Contains(resource.Name, "/") {
+				continue
+			}
+			match := candidate{gvr: groupVersion.WithResource(resource.Name), resource: resource}
+			switch {
+			case matchesResourceName(resource, token):
+				byName = append(byName, match)
+			case matchValue(resource.Categories, token):
+				byCategory = append(byCategory, match)
+			}
 		}
 	}
 
-	return empty, "", errors.New("resource kind not found")
+	candidates := byName
+	if len(candidates) == 0 {
+		candidates = byCategory
+	}
+	switch len(candidates) {
+	case 0:
+		return empty, metav1.APIResource{}, fmt.Errorf("%w: %q", errUnknownType, token)
+	case 1:
+		return candidates[0].gvr, candidates[0].resource, nil
+	}
+	names := make([]string, 0, len(candidates))
+	for _, match := range candidates {
+		names = append(names, (&Resource{GroupVersionKind: match.gvr.GroupVersion().WithKind(match.resource.Kind)}).typeSuffix())
+	}
+	sort.Strings(names)
+	return empty, metav1.APIResource{}, fmt.Errorf("resource type %q is ambiguous, use one of: %s", token, strings.Join(names, ", "))
+}
+
+func matchesResourceName(resource metav1.APIResource, token string) bool {
+	if strings.EqualFold(resource.Kind, token) || strings.EqualFold(resource.Name, token) || strings.EqualFold(resource.SingularName, token) {
+		return true
+	}
+	return matchValue(resource.ShortNames, token)
+}
+
+// preferredResources returns the preferred resources recorded by the last
+// API discovery, and only asks the API server when discovery has not run yet.
+func (k *KubeFS) preferredResources() ([]*metav1.APIResourceList, error) {
+	k.preferredMu.RLock()
+	resourceLists := k.preferred
+	k.preferredMu.RUnlock()
+	if resourceLists != nil {
+		return resourceLists, nil
+	}
+	resourceLists, err := discovery.ServerPreferredResources(k.DiscoveryClient)
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+	k.setPreferredResources(resourceLists, nil)
+	return resourceLists, nil
+}
+
+// setPreferredResources records the result of a discovery. Group versions
+// that failed discovery keep the resources recorded before.
+func (k *KubeFS) setPreferredResources(resourceLists []*metav1.APIResourceList, failedGroups map[schema.GroupVersion]bool) {
+	k.preferredMu.Lock()
+	defer k.preferredMu.Unlock()
+	for _, previous := range k.preferred {
+		if groupVersion, err := schema.ParseGroupVersion(previous.GroupVersion); err == nil && failedGroups[groupVersion] {
+			resourceLists = append(resourceLists, previous)
+		}
+	}
+	k.preferred = resourceLists
 }
@@ -0,0 +1,212 @@
+package kubefs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+var deploymentsGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+func newShortNameDiscovery() *fakediscovery.FakeDiscovery {
+	return &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", SingularName: "pod", Kind: "Pod", Namespaced: true, ShortNames: []string{"po"}, Categories: []string{"all"}},
+				{Name: "events", SingularName: "event", Kind: "Event", Namespaced: true, ShortNames: []string{"ev"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", SingularName: "deployment", Kind: "Deployment", Namespaced: true, ShortNames: []string{"deploy"}, Categories: []string{"all"}},
+				{Name: "deployments/scale", Kind: "Scale", Namespaced: true},
+			},
+		},
+		{
+			GroupVersion: "apps/v1beta2",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", SingularName: "deployment", Kind: "Deployment", Namespaced: true, ShortNames: []string{"deploy"}},
+			},
+		},
+		{
+			GroupVersion: "events.k8s.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "events", SingularName: "event", Kind: "Event", Namespaced: true, ShortNames: []string{"ev"}},
+			},
+		},
+		{
+			GroupVersion: "kafka.example.com/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "kafkatopics", SingularName: "kafkatopic", Kind: "KafkaTopic", Namespaced: true, Categories: []string{"kafka"}},
+			},
+		},
+	}}}
+}
+
+func childNames(n *Namespace) []string {
+	var names []string
+	for name := range n.Children() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestParseShortFilename(t *testing.T) {
+	cases := map[string]struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		"web.deploy.yaml":             {"web", "deploy", true},
+		"my.app.Deployment.yaml":      {"my.app", "deployment", true},
+		"web.yaml":                    {ok: false},
+		"web.deploy.yml":              {ok: false},
+		"web.deployment.apps.v1.yaml": {ok: false},
+	}
+	for filename, expected := range cases {
+		name, token, ok := parseShortFilename(filename)
+		if ok != expected.ok || name != expected.name || token != expected.token {
+			t.Fatalf("parseShortFilename(%q) = %q, %q, %t", filename, name, token, ok)
+		}
+	}
+}
+
+func TestResolveResource_ShortForms(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{Scope: ScopeCluster})
+	kfs.DiscoveryClient = newShortNameDiscovery()
+
+	for _, token := range []string{"deploy", "deployment", "deployments", "Deployment"} {
+		gvr, kind, err := kfs.ResolveResource("", "", token)
+		if err != nil {
+			t.Fatalf("resolve %q: unexpected error: %v", token, err)
+		}
+		if gvr != deploymentsGVR || kind != "Deployment" {
+			t.Fatalf("resolve %q: expected preferred apps/v1 deployments, got %v %s", token, gvr, kind)
+		}
+	}
+
+	gvr, _, err := kfs.ResolveResource("", "", "kafka")
+	if err != nil || gvr.Resource != "kafkatopics" {
+		t.Fatalf("expected category to resolve, got %v (%v)", gvr, err)
+	}
+	if gvr, _, err := kfs.ResolveResource("", "", "po"); err != nil || gvr.Resource != "pods" {
+		t.Fatalf("expected short name to win over categories, got %v (%v)", gvr, err)
+	}
+}
+
+func TestResolveResource_ShortFormsUseDiscoveredResources(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{Scope: ScopeCluster})
+	discovery := newShortNameDiscovery()
+	kfs.DiscoveryClient = discovery
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := kfs.ResolveResource("", "", "deploy"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if calls := len(discovery.Actions()); calls == 0 || calls > len(discovery.Resources)+1 {
+		t.Fatalf("expected a single discovery pass, got %d calls", calls)
+	}
+
+	// Later lookups only see what the last discovery recorded.
+	discovery.ClearActions()
+	kfs.setPreferredResources([]*metav1.APIResourceList{{
+		GroupVersion: "kafka.example.com/v1",
+		APIResources: []metav1.APIResource{{Name: "kafkatopics", SingularName: "kafkatopic", Kind: "KafkaTopic", Namespaced: true}},
+	}}, nil)
+	if gvr, _, err := kfs.ResolveResource("", "", "kafkatopic"); err != nil || gvr.Resource != "kafkatopics" {
+		t.Fatalf("expected the discovered resource to resolve, got %v (%v)", gvr, err)
+	}
+	if _, _, err := kfs.ResolveResource("", "", "deploy"); !errors.Is(err, errUnknownType) {
+		t.Fatalf("expected resources missing from discovery to be unknown, got %v", err)
+	}
+	if len(discovery.Actions()) != 0 {
+		t.Fatalf("expected no discovery calls, got %v", discovery.Actions())
+	}
+}
+
+func TestResolveResource_Ambiguous(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{Scope: ScopeCluster})
+	kfs.DiscoveryClient = newShortNameDiscovery()
+
+	_, _, err := kfs.ResolveResource("", "", "ev")
+	if err == nil {
+		t.Fatalf("expected ambiguity error")
+	}
+	if !strings.Contains(err.Error(), "event.core.v1, event.events.k8s.io.v1") {
+		t.Fatalf("expected candidates in error, got %v", err)
+	}
+	if _, _, err := kfs.ResolveResource("", "", "all"); err == nil {
+		t.Fatalf("expected category matching several resources to be ambiguous")
+	}
+	if gvr, _, err := kfs.ResolveResource("events.k8s.io", "", "ev"); err != nil || gvr.Group != "events.k8s.io" {
+		t.Fatalf("expected group to disambiguate, got %v (%v)", gvr, err)
+	}
+}
+
+func TestCreate_ShortFilename(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{Scope: ScopeCluster, AllowCreate: true})
+	kfs.DiscoveryClient = newShortNameDiscovery()
+	kfs.DynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{deploymentsGVR: "DeploymentList"})
+	kfs.AddNamespace(context.Background(), "dev", false)
+	dev := namespaceNode(kfs, "dev")
+
+	var out fuse.EntryOut
+	inode, handle, _, errno := dev.Create(context.Background(), "web.deploy.yaml", 0, 0644, &out)
+	if errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if names := childNames(dev); len(names) != 1 || names[0] != "web.deploy.yaml" {
+		t.Fatalf("expected the file to be listed under the typed name only, got %v", names)
+	}
+	fh := handle.(*resourceHandle)
+	if errno := fh.resource.applyYAML(context.Background(), fh.data); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if _, err := kfs.DynamicClient.Resource(deploymentsGVR).Namespace("dev").Get(context.Background(), "web", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected deployment to be created: %v", err)
+	}
+	if names := childNames(dev); len(names) != 1 || names[0] != "web.deployment.apps.v1.yaml" {
+		t.Fatalf("expected the file to move to its full name once applied, got %v", names)
+	}
+	if dev.GetChild("web.deployment.apps.v1.yaml") != inode {
+		t.Fatalf("expected the created file to keep its inode")
+	}
+
+	if _, _, _, errno := dev.Create(context.Background(), "web.ev.yaml", 0, 0644, &out); errno != syscall.EINVAL {
+		t.Fatalf("expected EINVAL for an ambiguous type, got %v", errno)
+	}
+}
+
+func TestCreate_ShortFilenameUnknownTypeIsScratch(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{Scope: ScopeCluster})
+	kfs.DiscoveryClient = newShortNameDiscovery()
+	kfs.DynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	kfs.AddNamespace(context.Background(), "dev", false)
+	dev := namespaceNode(kfs, "dev")
+
+	for _, name := range []string{"notes.draft.yaml", "a.b.c.yaml"} {
+		var out fuse.EntryOut
+		if _, _, _, errno := dev.Create(context.Background(), name, 0, 0644, &out); errno != 0 {
+			t.Fatalf("create %s: unexpected errno: %v", name, errno)
+		}
+		if dev.scratchFile(name) == nil {
+			t.Fatalf("expected %s to be a scratch file", name)
+		}
+	}
+}
@@ -1,47 +1,303 @@
 package kubefs
 
 import (
+	"fmt"
+	"path"
 	"strings"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
 )
 
+// FilterRule matches resources by type and, optionally, individual objects.
+// Every field that is set must match. Names accept glob patterns, and
+// Namespaces globs and /regex/ entries like the top-level namespaces list.
 type FilterRule struct {
-	ApiGroups []string `yaml:"apiGroups" json:"apiGroups"`
-	Resources []string `yaml:"resources" json:"resources"`
+	ApiGroups     []string `yaml:"apiGroups" json:"apiGroups"`
+	Versions      []string `yaml:"versions" json:"versions"`
+	Resources     []string `yaml:"resources" json:"resources"`
+	Kinds         []string `yaml:"kinds" json:"kinds"`
+	Namespaces    []string `yaml:"namespaces" json:"namespaces"`
+	Names         []string `yaml:"names" json:"names"`
+	LabelSelector string   `yaml:"labelSelector" json:"labelSelector"`
+	FieldSelector string   `yaml:"fieldSelector" json:"fieldSelector"`
 }
 
-func (k *KubeFS) AllowsResource(gvr schema.GroupVersionResource) bool {
-	cfg := k.GetConfig()
-	allowed := matchesAnyRule(cfg.AllowRules, gvr)
-	if len(cfg.AllowRules) == 0 {
-		allowed = true
+// compiledRule is a FilterRule with its selectors parsed once.
+type compiledRule struct {
+	FilterRule
+	namespaces *namespaceMatcher
+	labels     labels.Selector
+	fields     fields.Selector
+}
+
+type filterSet struct {
+	allow   []compiledRule
+	deny    []compiledRule
+	cluster []compiledRule
+}
+
+// listSelectors are the label and field selectors sent to the API server
+// when listing and watching a resource.
+type listSelectors struct {
+	label string
+	field string
+}
+
+func newFilterSet(cfg Config) (*filterSet, error) {
+	allow, err := compileRules("allow", cfg.AllowRules)
+	if err != nil {
+		return nil, err
 	}
-	if matchesAnyRule(cfg.DenyRules, gvr) {
-		return false
+	deny, err := compileRules("deny", cfg.DenyRules)
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := compileRules("clusterResources", cfg.ClusterResources)
+	if err != nil {
+		return nil, err
+	}
+	return &filterSet{allow: allow, deny: deny, cluster: cluster}, nil
+}
+
+func compileRules(kind string, rules []FilterRule) ([]compiledRule, error) {
+	result := make([]compiledRule, 0, len(rules))
+	for index, rule := range rules {
+		compiled := compiledRule{FilterRule: rule}
+		for _, pattern := range rule.Names {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q in %s rule %d: %w", pattern, kind, index, err)
+			}
+		}
+		if len(rule.Namespaces) > 0 {
+			namespaces, err := newNamespacePatterns(rule.Namespaces)
+			if err != nil {
+				return nil, fmt.Errorf("%s rule %d: %w", kind, index, err)
+			}
+			compiled.namespaces = namespaces
+		}
+		if rule.LabelSelector != "" {
+			selector, err := labels.Parse(rule.LabelSelector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid labelSelector in %s rule %d: %w", kind, index, err)
+			}
+			compiled.labels = selector
+		}
+		if rule.FieldSelector != "" {
+			selector, err := fields.ParseSelector(rule.FieldSelector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid fieldSelector in %s rule %d: %w", kind, index, err)
+			}
+			compiled.fields = selector
+		}
+		result = append(result, compiled)
+	}
+	return result, nil
+}
+
+func buildFilterSet(config Config) *filterSet {
+	filters, err := newFilterSet(config)
+	if err != nil {
+		Errorf("Ignoring filters: %v", err)
+		filters, _ = newFilterSet(Config{})
+	}
+	return filters
+}
+
+func (k *KubeFS) filterSet() *filterSet {
+	k.configMu.RLock()
+	defer k.configMu.RUnlock()
+	return k.filters
+}
+
+// allowRules returns the allow rules for namespaced or cluster-scoped
+// resources, and whether an empty list allows everything. In namespace scope,
+// cluster-scoped resources are only shown when a clusterResources rule
+// allows them.
+func (k *KubeFS) allowRules(filters *filterSet, clusterScoped bool) ([]compiledRule, bool) {
+	if clusterScoped && !k.IsClusterScope() {
+		return filters.cluster, false
+	}
+	return filters.allow, true
+}
+
+// AllowsResource reports whether objects of a namespaced resource type, or of
+// any resource type in cluster scope, can be shown at all. Rules that only
+// match some objects do not deny the whole type.
+func (k *KubeFS) AllowsResource(gvr schema.GroupVersionResource, kind string) bool {
+	return k.allowsType(gvr, kind, false)
+}
+
+// AllowsClusterResource is AllowsResource for cluster-scoped resource types.
+func (k *KubeFS) AllowsClusterResource(gvr schema.GroupVersionResource, kind string) bool {
+	return k.allowsType(gvr, kind, true)
+}
+
+func (k *KubeFS) allowsType(gvr schema.GroupVersionResource, kind string, clusterScoped bool) bool {
+	filters := k.filterSet()
+	for _, rule := range filters.deny {
+		if !rule.selectsObjects() && rule.matchesType(gvr, kind) {
+			return false
+		}
+	}
+	allow, emptyAllows := k.allowRules(filters, clusterScoped)
+	if len(allow) == 0 {
+		return emptyAllows
+	}
+	for _, rule := range allow {
+		if rule.matchesType(gvr, kind) {
+			return true
+		}
 	}
-	return allowed
+	return false
 }
 
-func matchesAnyRule(rules []FilterRule, gvr schema.GroupVersionResource) bool {
-	for _, rule := range rules {
-		if ruleMatches(rule, gvr) {
+// AllowsObject reports whether a single object passes the filters. Objects
+// without a namespace are checked as cluster-scoped.
+func (k *KubeFS) AllowsObject(gvr schema.GroupVersionResource, kind string, object metav1.Object) bool {
+	filters := k.filterSet()
+	for _, rule := range filters.deny {
+		if rule.matchesObject(gvr, kind, object) {
+			return false
+		}
+	}
+	allow, emptyAllows := k.allowRules(filters, object.GetNamespace() == "")
+	if len(allow) == 0 {
+		return emptyAllows
+	}
+	for _, rule := range allow {
+		if rule.matchesObject(gvr, kind, object) {
 			return true
 		}
 	}
 	return false
 }
 
-func ruleMatches(rule FilterRule, gvr schema.GroupVersionResource) bool {
-	if len(rule.ApiGroups) > 0 && !matchGroup(rule.ApiGroups, gvr.Group) {
+// listSelectors returns the selectors that can be pushed down to the API
+// server for a resource type. They are only used when every allow rule
+// matching the type asks for the same selectors; otherwise objects are
+// filtered client-side.
+func (k *KubeFS) listSelectors(gvr schema.GroupVersionResource, kind string, clusterScoped bool) listSelectors {
+	filters := k.filterSet()
+	allow, _ := k.allowRules(filters, clusterScoped)
+	var result listSelectors
+	matched := false
+	for _, rule := range allow {
+		if !rule.matchesType(gvr, kind) {
+			continue
+		}
+		selectors := listSelectors{label: rule.LabelSelector, field: rule.FieldSelector}
+		if matched && selectors != result {
+			return listSelectors{}
+		}
+		result = selectors
+		matched = true
+	}
+	return result
+}
+
+func (s listSelectors) tweak() func(*metav1.ListOptions) {
+	if s == (listSelectors{}) {
+		return nil
+	}
+	return func(options *metav1.ListOptions) {
+		options.LabelSelector = s.label
+		options.FieldSelector = s.field
+	}
+}
+
+func (r FilterRule) empty() bool {
+	return len(r.ApiGroups) == 0 && len(r.Versions) == 0 && len(r.Resources) == 0 && len(r.Kinds) == 0 &&
+		len(r.Namespaces) == 0 && len(r.Names) == 0 && r.LabelSelector == "" && r.FieldSelector == ""
+}
+
+func (r compiledRule) selectsObjects() bool {
+	return len(r.Namespaces) > 0 || len(r.Names) > 0 || r.labels != nil || r.fields != nil
+}
+
+func (r compiledRule) matchesType(gvr schema.GroupVersionResource, kind string) bool {
+	if len(r.ApiGroups) > 0 && !matchGroup(r.ApiGroups, gvr.Group) {
+		return false
+	}
+	if len(r.Versions) > 0 && !matchValue(r.Versions, gvr.Version) {
+		return false
+	}
+	if len(r.Resources) > 0 && !matchValue(r.Resources, gvr.Resource) {
 		return false
 	}
-	if len(rule.Resources) > 0 && !matchValue(rule.Resources, gvr.Resource) {
+	if len(r.Kinds) > 0 && !matchValue(r.Kinds, kind) {
 		return false
 	}
 	return true
 }
 
+func (r compiledRule) matchesObject(gvr schema.GroupVersionResource, kind string, object metav1.Object) bool {
+	if !r.matchesType(gvr, kind) {
+		return false
+	}
+	if r.namespaces != nil && !r.namespaces.matchesName(object.GetNamespace()) {
+		return false
+	}
+	if len(r.Names) > 0 && !matchPattern(r.Names, object.GetName()) {
+		return false
+	}
+	if r.labels != nil && !r.labels.Matches(labels.Set(object.GetLabels())) {
+		return false
+	}
+	if r.fields != nil && !matchFields(r.fields, object) {
+		return false
+	}
+	return true
+}
+
+// matchFields evaluates a field selector against an object. Fields that are
+// not available, such as spec fields of metadata-only objects, are left to
+// the API server, which already applied the selector when listing.
+func matchFields(selector fields.Selector, object metav1.Object) bool {
+	for _, requirement := range selector.Requirements() {
+		value, ok := objectField(object, requirement.Field)
+		if !ok {
+			continue
+		}
+		switch requirement.Operator {
+		case selection.Equals, selection.DoubleEquals:
+			if value != requirement.Value {
+				return false
+			}
+		case selection.NotEquals:
+			if value == requirement.Value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func objectField(object metav1.Object, field string) (string, bool) {
+	switch field {
+	case "metadata.name":
+		return object.GetName(), true
+	case "metadata.namespace":
+		return object.GetNamespace(), true
+	}
+	full, ok := object.(*unstructured.Unstructured)
+	if !ok {
+		return "", false
+	}
+	value, found, err := unstructured.NestedFieldNoCopy(full.Object, strings.Split(field, ".")...)
+	if err != nil {
+		return "", false
+	}
+	if !found || value == nil {
+		return "", true
+	}
+	return fmt.Sprint(value), true
+}
+
 func matchGroup(groups []string, group string) bool {
 	if len(groups) == 0 {
 		return true
@@ -63,3 +319,12 @@ func matchValue(values []string, value string) bool {
 	}
 	return false
 }
+
+func matchPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
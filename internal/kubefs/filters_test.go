@@ -1,8 +1,11 @@
 package kubefs
 
 import (
+	"context"
 	"testing"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
@@ -10,7 +13,7 @@ func TestAllowsResource_DefaultAllow(t *testing.T) {
 	kfs := NewKubeFS(Config{Scope: ScopeCluster})
 	gvr := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
 
-	if !kfs.AllowsResource(gvr) {
+	if !kfs.AllowsResource(gvr, "") {
 		t.Fatalf("expected resource to be allowed when no allow/deny rules are set")
 	}
 }
@@ -27,10 +30,10 @@ func TestAllowsResource_AllowRulesWithCoreGroup(t *testing.T) {
 	allowed := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
 	denied := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "services"}
 
-	if !kfs.AllowsResource(allowed) {
+	if !kfs.AllowsResource(allowed, "") {
 		t.Fatalf("expected core pods to be allowed")
 	}
-	if kfs.AllowsResource(denied) {
+	if kfs.AllowsResource(denied, "") {
 		t.Fatalf("expected core services to be denied when allow rules are set")
 	}
 }
@@ -50,10 +53,10 @@ func TestAllowsResource_DenyOverridesAllow(t *testing.T) {
 	allowed := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
 	denied := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "services"}
 
-	if !kfs.AllowsResource(allowed) {
+	if !kfs.AllowsResource(allowed, "") {
 		t.Fatalf("expected core pods to be allowed")
 	}
-	if kfs.AllowsResource(denied) {
+	if kfs.AllowsResource(denied, "") {
 		t.Fatalf("expected core services to be denied by deny rules")
 	}
 }
@@ -67,3 +70,199 @@ func TestNormalizeGroups_CoreLiteral(t *testing.T) {
 		t.Fatalf("unexpected groups: %v", groups)
 	}
 }
+
+func TestAllowsResource_KindsAndVersions(t *testing.T) {
+	kfs := NewKubeFS(Config{
+		Scope:      ScopeCluster,
+		AllowRules: []FilterRule{{Kinds: []string{"deployment"}, Versions: []string{"v1"}}},
+	})
+
+	if !kfs.AllowsResource(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, "Deployment") {
+		t.Fatalf("expected apps/v1 deployments to be allowed")
+	}
+	if kfs.AllowsResource(schema.GroupVersionResource{Group: "apps", Version: "v1beta1", Resource: "deployments"}, "Deployment") {
+		t.Fatalf("expected other versions to be denied")
+	}
+	if kfs.AllowsResource(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}, "StatefulSet") {
+		t.Fatalf("expected other kinds to be denied")
+	}
+}
+
+func TestAllowsObject_DenyByName(t *testing.T) {
+	kfs := NewKubeFS(Config{
+		Scope:     ScopeCluster,
+		DenyRules: []FilterRule{{Kinds: []string{"configmap"}, Names: []string{"kube-root-ca.crt"}}},
+	})
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+	if !kfs.AllowsResource(gvr, "ConfigMap") {
+		t.Fatalf("expected a name-based deny rule not to deny the whole type")
+	}
+	if kfs.AllowsObject(gvr, "ConfigMap", &metav1.ObjectMeta{Name: "kube-root-ca.crt", Namespace: "dev"}) {
+		t.Fatalf("expected kube-root-ca.crt to be denied")
+	}
+	if !kfs.AllowsObject(gvr, "ConfigMap", &metav1.ObjectMeta{Name: "settings", Namespace: "dev"}) {
+		t.Fatalf("expected other configmaps to be allowed")
+	}
+}
+
+func TestAllowsObject_LabelsFieldsAndNamespaces(t *testing.T) {
+	kfs := NewKubeFS(Config{
+		Scope: ScopeCluster,
+		AllowRules: []FilterRule{{
+			Resources:     []string{"pods"},
+			Namespaces:    []string{"shop-*"},
+			LabelSelector: "app.kubernetes.io/part-of=checkout",
+			FieldSelector: "spec.nodeName=node-1",
+		}},
+	})
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	pod := func(namespace string, partOf string, node string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{"nodeName": node}}}
+		obj.SetName("web")
+		obj.SetNamespace(namespace)
+		obj.SetLabels(map[string]string{"app.kubernetes.io/part-of": partOf})
+		return obj
+	}
+
+	if !kfs.AllowsObject(gvr, "Pod", pod("shop-eu", "checkout", "node-1")) {
+		t.Fatalf("expected matching pod to be allowed")
+	}
+	if kfs.AllowsObject(gvr, "Pod", pod("shop-eu", "catalog", "node-1")) {
+		t.Fatalf("expected pod with other labels to be denied")
+	}
+	if kfs.AllowsObject(gvr, "Pod", pod("dev", "checkout", "node-1")) {
+		t.Fatalf("expected pod in other namespaces to be denied")
+	}
+	if kfs.AllowsObject(gvr, "Pod", pod("shop-eu", "checkout", "node-2")) {
+		t.Fatalf("expected pod on other nodes to be denied")
+	}
+
+	metadataOnly := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{
+		Name:      "web",
+		Namespace: "shop-eu",
+		Labels:    map[string]string{"app.kubernetes.io/part-of": "checkout"},
+	}}
+	if !kfs.AllowsObject(gvr, "Pod", metadataOnly) {
+		t.Fatalf("expected unavailable fields to be left to the API server")
+	}
+}
+
+func TestAllowsObject_NamespaceRegexps(t *testing.T) {
+	kfs := NewKubeFS(Config{
+		Scope:     ScopeCluster,
+		DenyRules: []FilterRule{{Kinds: []string{"ConfigMap"}, Namespaces: []string{"/^pr-[0-9]+$/", "kube-system"}}},
+	})
+
+	for namespace, allowed := range map[string]bool{"pr-42": false, "kube-system": false, "pr-x": true, "dev": true} {
+		if kfs.AllowsObject(configMapsGVR, "ConfigMap", &metav1.ObjectMeta{Name: "settings", Namespace: namespace}) != allowed {
+			t.Fatalf("expected configmaps in %s to be allowed=%t", namespace, allowed)
+		}
+	}
+	if _, err := ParseConfig([]byte("deny:\n  - namespaces: [\"/pr-(/\"]\n")); err == nil {
+		t.Fatalf("expected an invalid namespace regexp to be rejected")
+	}
+}
+
+func TestAllowsObject_RulePatternsKeepCase(t *testing.T) {
+	cfg, err := ParseConfig([]byte("deny:\n  - namespaces: ['/^pr-\\D+$/']\n    names: ['[A-Z]*']\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kfs := NewKubeFS(cfg)
+
+	cases := []struct {
+		namespace string
+		name      string
+		allowed   bool
+	}{
+		{"pr-abc", "Settings", false},
+		{"pr-42", "Settings", true},
+		{"pr-abc", "settings", true},
+	}
+	for _, c := range cases {
+		if kfs.AllowsObject(configMapsGVR, "ConfigMap", &metav1.ObjectMeta{Name: c.name, Namespace: c.namespace}) != c.allowed {
+			t.Fatalf("expected %s/%s to be allowed=%t", c.namespace, c.name, c.allowed)
+		}
+	}
+}
+
+func TestListSelectors(t *testing.T) {
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	services := schema.GroupVersionResource{Version: "v1", Resource: "services"}
+	kfs := NewKubeFS(Config{
+		Scope: ScopeCluster,
+		AllowRules: []FilterRule{
+			{Resources: []string{"pods"}, LabelSelector: "app=web"},
+			{Resources: []string{"pods", "services"}, LabelSelector: "app=web", FieldSelector: "metadata.name=web"},
+			{Resources: []string{"services"}, LabelSelector: "app=web", FieldSelector: "metadata.name=web"},
+		},
+	})
+
+	if selectors := kfs.listSelectors(pods, "Pod", false); selectors != (listSelectors{}) {
+		t.Fatalf("expected no pushdown for differing rules, got %+v", selectors)
+	}
+	if selectors := kfs.listSelectors(services, "Service", false); selectors != (listSelectors{label: "app=web", field: "metadata.name=web"}) {
+		t.Fatalf("unexpected selectors for services: %+v", selectors)
+	}
+}
+
+func TestParseConfig_RejectsInvalidFilterSelectors(t *testing.T) {
+	for _, data := range []string{
+		"allow:\n  - labelSelector: 'app in (web'\n",
+		"deny:\n  - fieldSelector: 'spec.nodeName'\n",
+		"deny:\n  - names: ['web-[']\n",
+	} {
+		if _, err := ParseConfig([]byte(data)); err == nil {
+			t.Fatalf("expected error for %q", data)
+		}
+	}
+}
+
+func TestAllowsClusterResource_NamespaceScope(t *testing.T) {
+	clusterRoles := schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}
+	nodes := schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+	kfs := NewKubeFS(Config{
+		Scope:            ScopeNamespace,
+		Namespaces:       []string{"dev"},
+		ClusterResources: []FilterRule{{Kinds: []string{"ClusterRole"}}},
+	})
+
+	if !kfs.AllowsClusterResource(clusterRoles, "ClusterRole") {
+		t.Fatalf("expected clusterroles to be allowed by clusterResources")
+	}
+	if kfs.AllowsClusterResource(nodes, "Node") {
+		t.Fatalf("expected other cluster resources to stay hidden in namespace scope")
+	}
+
+	kfs.SetConfig(Config{Scope: ScopeNamespace, Namespaces: []string{"dev"}})
+	if kfs.AllowsClusterResource(clusterRoles, "ClusterRole") {
+		t.Fatalf("expected no cluster resources without clusterResources")
+	}
+}
+
+func TestAddResource_ClusterResourcesInNamespaceScope(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{
+		Scope:            ScopeNamespace,
+		Namespaces:       []string{"dev"},
+		ClusterResources: []FilterRule{{Kinds: []string{"StorageClass"}}},
+	})
+	ctx := context.Background()
+	kfs.ReconcileNamespaces(ctx)
+
+	clusterwide := kfs.GetChild("clusterwide")
+	if clusterwide == nil {
+		t.Fatalf("expected clusterwide directory when clusterResources are configured")
+	}
+	kfs.AddResource(ctx, "standard", "storageclasses", "", schema.GroupVersionKind{Group: "storage.k8s.io", Version: "v1", Kind: "StorageClass"})
+	kfs.AddResource(ctx, "node-1", "nodes", "", schema.GroupVersionKind{Version: "v1", Kind: "Node"})
+	if len(clusterwide.Children()) != 1 || clusterwide.GetChild("standard.storageclass.storage.k8s.io.v1.yaml") == nil {
+		t.Fatalf("unexpected clusterwide files: %v", clusterwide.Children())
+	}
+
+	kfs.SetConfig(Config{Scope: ScopeNamespace, Namespaces: []string{"dev"}})
+	kfs.ReconcileNamespaces(ctx)
+	if kfs.GetChild("clusterwide") != nil {
+		t.Fatalf("expected clusterwide directory to be removed without clusterResources")
+	}
+}
@@ -0,0 +1,55 @@
+package kubefs
+
+import (
+	"strings"
+	"time"
+)
+
+// generateNameMarker ends the name part of a filename that creates an object
+// with metadata.generateName: "+.job.batch.v1.yaml" or "migrate-+.job.batch.v1.yaml".
+// The file is replaced by the file named after the server-assigned name once
+// the object is created.
+const generateNameMarker = "+"
+
+// generateNamePrefix returns the generateName prefix encoded in the name part
+// of a filename. An empty prefix takes metadata.generateName from the YAML.
+func generateNamePrefix(name string) (string, bool) {
+	if !strings.HasSuffix(name, generateNameMarker) {
+		return "", false
+	}
+	return strings.TrimSuffix(name, generateNameMarker), true
+}
+
+func (r *Resource) isGenerating() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.generating
+}
+
+// defaultGenerateName is used in the skeleton when the filename gives no
+// prefix.
+func defaultGenerateName(res *Resource) string {
+	if prefix, _ := generateNamePrefix(res.Name); prefix != "" {
+		return prefix
+	}
+	return strings.ToLower(res.GroupVersionKind.Kind) + "-"
+}
+
+// assignGeneratedName points a generateName entry at the object the server
+// created and moves its file to the assigned name, so further saves update
+// that object.
+func (r *Resource) assignGeneratedName(name string) {
+	oldFilename := r.listedName()
+	r.mu.Lock()
+	r.Name = name
+	r.alias = ""
+	r.generating = false
+	r.draft = nil
+	r.changes++
+	r.updatedAt = time.Now()
+	r.mu.Unlock()
+
+	ns := r.Namespace
+	ns.MvChild(oldFilename, &ns.Inode, r.Filename(), true)
+	Infof("Created %s from %s", r.logRef(), oldFilename)
+}
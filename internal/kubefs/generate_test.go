@@ -0,0 +1,101 @@
+package kubefs
+
+import (
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// generateNames makes the fake client assign names like the API server does.
+func generateNames(client *dynamicfake.FakeDynamicClient) {
+	client.PrependReactor("create", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		obj := action.(clienttesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		if obj.GetName() == "" && obj.GetGenerateName() != "" {
+			obj.SetName(obj.GetGenerateName() + "x7k2p")
+		}
+		return false, nil, nil
+	})
+}
+
+func TestCreate_GenerateNameFile(t *testing.T) {
+	kfs, client := newRenameFixture(t)
+	kfs.DiscoveryClient = newCoreDiscovery()
+	generateNames(client)
+	dev := namespaceNode(kfs, "dev")
+
+	var out fuse.EntryOut
+	_, handle, _, errno := dev.Create(context.Background(), "job-+.configmap.core.v1.yaml", 0, 0644, &out)
+	if errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	fh := handle.(*resourceHandle)
+	if !strings.Contains(string(fh.data), "generateName: job-") {
+		t.Fatalf("expected skeleton to use generateName, got:\n%s", fh.data)
+	}
+	if errno := fh.resource.applyYAML(context.Background(), fh.data); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+
+	if dev.GetChild("job-+.configmap.core.v1.yaml") != nil {
+		t.Fatalf("expected generateName entry to be replaced")
+	}
+	child := dev.GetChild("job-x7k2p.configmap.core.v1.yaml")
+	if child == nil {
+		t.Fatalf("expected file for the generated name")
+	}
+	if res := child.Operations().(*Resource); res.Name != "job-x7k2p" || res.isGenerating() {
+		t.Fatalf("expected resource to point at the created object, got %q", res.Name)
+	}
+}
+
+func TestApplyYAML_GenerateNameRejectsName(t *testing.T) {
+	kfs, _ := newRenameFixture(t)
+	dev := namespaceNode(kfs, "dev")
+	res := &Resource{Name: "+", Namespace: dev, GroupVersionResource: configMapsGVR, KubeFS: kfs, generating: true}
+
+	errno := res.applyYAML(context.Background(), []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: fixed\n"))
+	if errno != syscall.EINVAL {
+		t.Fatalf("expected EINVAL, got %v", errno)
+	}
+}
+
+func TestApplyYAML_GenerateNameCreatesOnce(t *testing.T) {
+	kfs, client := newRenameFixture(t)
+	dev := namespaceNode(kfs, "dev")
+	creates := 0
+	client.PrependReactor("create", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		creates++
+		return true, nil, apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "dev")
+	})
+	res := &Resource{Name: "+", Namespace: dev, GroupVersionResource: configMapsGVR, KubeFS: kfs, generating: true}
+
+	errno := res.applyYAML(context.Background(), []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  generateName: job-\n"))
+	if errno == 0 || creates != 1 {
+		t.Fatalf("expected the failed create not to be retried, got errno %v after %d creates", errno, creates)
+	}
+	if !res.isGenerating() {
+		t.Fatalf("expected the file to keep its generateName entry")
+	}
+}
+
+func TestApplyDir_GenerateName(t *testing.T) {
+	dir, client := newApplyFixture(t, Config{Scope: ScopeCluster, AllowCreate: true})
+	generateNames(client)
+
+	manifest := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  generateName: run-\n  namespace: dev\n"
+	if errno := dropManifest(t, dir, "run.yaml", manifest); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if !strings.Contains(readResult(t, dir, "run.yaml"), "name: run-x7k2p") {
+		t.Fatalf("expected generated name in result:\n%s", readResult(t, dir, "run.yaml"))
+	}
+}
@@ -0,0 +1,61 @@
+package kubefs
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// generatedFile is a read-only file whose content is rendered on every open,
+// used for status and report files that kubefs exposes about itself.
+type generatedFile struct {
+	content func() []byte
+
+	fs.Inode
+}
+
+var _ = (fs.NodeGetattrer)((*generatedFile)(nil))
+var _ = (fs.NodeOpener)((*generatedFile)(nil))
+
+func newGeneratedFile(content func() []byte) *generatedFile {
+	return &generatedFile{content: content}
+}
+
+func (g *generatedFile) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = fuse.S_IFREG | 0444
+	out.Size = uint64(len(g.content()))
+	now := uint64(time.Now().Unix())
+	out.Mtime = now
+	out.Ctime = now
+	out.Atime = now
+	return 0
+}
+
+func (g *generatedFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&syscall.O_ACCMODE != syscall.O_RDONLY {
+		return nil, 0, syscall.EACCES
+	}
+	return &generatedHandle{data: g.content()}, fuse.FOPEN_DIRECT_IO, 0
+}
+
+// generatedHandle holds the content rendered when the file was opened, so a
+// reader sees a consistent snapshot across multiple reads.
+type generatedHandle struct {
+	data []byte
+}
+
+var _ = (fs.FileReader)((*generatedHandle)(nil))
+
+func (h *generatedHandle) Read(ctx context.Context, dest []byte, offset int64) (fuse.ReadResult, syscall.Errno) {
+	if offset > int64(len(h.data)) {
+		return fuse.ReadResultData(nil), 0
+	}
+	end := offset + int64(len(dest))
+	if end > int64(len(h.data)) {
+		end = int64(len(h.data))
+	}
+	return fuse.ReadResultData(h.data[offset:end]), 0
+}
@@ -0,0 +1,71 @@
+package kubefs
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func testResource() *Resource {
+	return &Resource{
+		Name:             "web",
+		GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+	}
+}
+
+func TestResourceHandle_WritesAreIsolated(t *testing.T) {
+	res := testResource()
+	reader := &resourceHandle{resource: res, data: []byte("original")}
+	writer := &resourceHandle{resource: res, data: []byte("original"), writable: true}
+
+	if _, errno := writer.Write(context.Background(), []byte("edited!!"), 0); errno != 0 {
+		t.Fatalf("unexpected write error: %v", errno)
+	}
+
+	dest := make([]byte, 64)
+	result, errno := reader.Read(context.Background(), dest, 0)
+	if errno != 0 {
+		t.Fatalf("unexpected read error: %v", errno)
+	}
+	data, _ := result.Bytes(dest)
+	if string(data) != "original" {
+		t.Fatalf("reader observed writer buffer: %q", data)
+	}
+	if !writer.dirty || reader.dirty {
+		t.Fatalf("expected only the writer to be dirty")
+	}
+}
+
+func TestResourceHandle_ReadOnlyRejectsWrites(t *testing.T) {
+	handle := &resourceHandle{resource: testResource(), data: []byte("original")}
+
+	if _, errno := handle.Write(context.Background(), []byte("x"), 0); errno != syscall.EBADF {
+		t.Fatalf("expected EBADF, got %v", errno)
+	}
+	if errno := handle.truncate(0); errno != syscall.EBADF {
+		t.Fatalf("expected EBADF on truncate, got %v", errno)
+	}
+}
+
+func TestResourceHandle_Truncate(t *testing.T) {
+	handle := &resourceHandle{resource: testResource(), data: []byte("original"), writable: true}
+
+	if errno := handle.truncate(0); errno != 0 {
+		t.Fatalf("unexpected truncate error: %v", errno)
+	}
+	if len(handle.data) != 0 || !handle.dirty {
+		t.Fatalf("expected empty dirty buffer, got %q dirty=%v", handle.data, handle.dirty)
+	}
+}
+
+func TestResource_TruncateWithoutHandle(t *testing.T) {
+	res := testResource()
+	in := &fuse.SetAttrIn{SetAttrInCommon: fuse.SetAttrInCommon{Valid: fuse.FATTR_SIZE}}
+
+	if errno := res.Setattr(context.Background(), nil, in, &fuse.AttrOut{}); errno != syscall.EPERM {
+		t.Fatalf("expected EPERM, got %v", errno)
+	}
+}
@@ -0,0 +1,673 @@
+package kubefs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+type informerKey struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+}
+
+type managedInformer struct {
+	key       informerKey
+	kind      string
+	selectors listSelectors
+	informer  cache.SharedIndexInformer
+	ctx       context.Context
+	cancel    context.CancelFunc
+	synced    chan struct{}
+	lastUsed  atomic.Int64
+}
+
+// lazyTarget is an informer that discovery found but that is only started
+// once something in the tree needs it.
+type lazyTarget struct {
+	kind       string
+	namespaced bool
+}
+
+func (m *managedInformer) gvk() schema.GroupVersionKind {
+	return m.key.gvr.GroupVersion().WithKind(m.kind)
+}
+
+// informerTarget is an informer that discovery wants running.
+type informerTarget struct {
+	key        informerKey
+	kind       string
+	namespaced bool
+}
+
+const (
+	syncStatePending = "pending"
+	syncStateSynced  = "synced"
+	syncStateFailed  = "failed"
+)
+
+type syncStatus struct {
+	state  string
+	detail string
+}
+
+// informerManager owns every dynamic informer started for a KubeFS. Each
+// GVR/namespace pair runs under its own context so it can be stopped
+// individually, and stopping it removes the files it produced.
+type informerManager struct {
+	kubefs *KubeFS
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	informers map[informerKey]*managedInformer
+	lazy      map[informerKey]lazyTarget
+	status    map[informerKey]syncStatus
+	// discovered holds the keys registered by API discovery, as opposed to
+	// the CRD informer, so a refresh only retires what discovery added.
+	discovered map[informerKey]struct{}
+
+	// queued holds targets waiting for the queue worker, which registers
+	// them in batches so event handlers never block on a cache sync.
+	queueMu     sync.Mutex
+	queued      []informerTarget
+	queueClient dynamic.Interface
+	draining    bool
+}
+
+func newInformerManager(kubefs *KubeFS) *informerManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &informerManager{
+		kubefs:     kubefs,
+		ctx:        ctx,
+		cancel:     cancel,
+		informers:  make(map[informerKey]*managedInformer),
+		lazy:       make(map[informerKey]lazyTarget),
+		status:     make(map[informerKey]syncStatus),
+		discovered: make(map[informerKey]struct{}),
+	}
+}
+
+// Done is closed once the manager has been shut down.
+func (m *informerManager) Done() <-chan struct{} {
+	return m.ctx.Done()
+}
+
+// register starts the informer right away, or only records it when lazy
+// informers are enabled.
+func (m *informerManager) register(dynamicClient dynamic.Interface, gvr schema.GroupVersionResource, kind string, namespace string, namespaced bool) {
+	if !m.kubefs.GetConfig().Lazy.Enabled {
+		m.start(dynamicClient, gvr, kind, namespace)
+		return
+	}
+	m.mu.Lock()
+	m.lazy[informerKey{gvr: gvr, namespace: namespace}] = lazyTarget{kind: kind, namespaced: namespaced}
+	m.mu.Unlock()
+	Debugf("Registered lazy informer for resource: %s (Kind: %s, Namespace: %s)", gvr.String(), kind, namespace)
+}
+
+// registerAll registers every target, starting them concurrently on a bounded
+// worker pool unless lazy informers are enabled.
+func (m *informerManager) registerAll(dynamicClient dynamic.Interface, targets []informerTarget) {
+	if !m.kubefs.GetConfig().Lazy.Enabled {
+		m.startAll(dynamicClient, targets)
+		return
+	}
+	for _, target := range targets {
+		m.register(dynamicClient, target.key.gvr, target.kind, target.key.namespace, target.namespaced)
+	}
+}
+
+// enqueue registers targets in the background through registerAll. Targets
+// queued while a batch is starting are registered in the next one.
+func (m *informerManager) enqueue(dynamicClient dynamic.Interface, targets []informerTarget) {
+	if len(targets) == 0 {
+		return
+	}
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+	m.queued = append(m.queued, targets...)
+	m.queueClient = dynamicClient
+	if m.draining {
+		return
+	}
+	m.draining = true
+	go m.drainQueue()
+}
+
+func (m *informerManager) drainQueue() {
+	for {
+		m.queueMu.Lock()
+		batch, dynamicClient := m.queued, m.queueClient
+		m.queued = nil
+		if len(batch) == 0 || m.ctx.Err() != nil {
+			m.draining = false
+			m.queueMu.Unlock()
+			return
+		}
+		m.queueMu.Unlock()
+		m.registerAll(dynamicClient, batch)
+	}
+}
+
+// reconcileDiscovered makes the discovered informers match targets. Keys whose
+// group version failed discovery are left alone rather than treated as gone.
+func (m *informerManager) reconcileDiscovered(dynamicClient dynamic.Interface, targets []informerTarget, failedGroups map[schema.GroupVersion]bool) {
+	desired := make(map[informerKey]struct{}, len(targets))
+	for _, target := range targets {
+		desired[target.key] = struct{}{}
+	}
+
+	m.mu.Lock()
+	var stale []informerKey
+	for key := range m.discovered {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+		if failedGroups[key.gvr.GroupVersion()] {
+			continue
+		}
+		stale = append(stale, key)
+		delete(m.discovered, key)
+		delete(m.lazy, key)
+	}
+	added := make([]informerTarget, 0)
+	for _, target := range targets {
+		m.discovered[target.key] = struct{}{}
+		_, running := m.informers[target.key]
+		_, registered := m.lazy[target.key]
+		if !running && !registered {
+			added = append(added, target)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, key := range stale {
+		Infof("API %s is no longer served; removing its files", gvrPath(key.gvr))
+		m.stop(key)
+	}
+	if len(added) > 0 {
+		Infof("Starting %d informers...", len(added))
+		m.registerAll(dynamicClient, added)
+	}
+}
+
+func (m *informerManager) startAll(dynamicClient dynamic.Interface, targets []informerTarget) {
+	workers := m.kubefs.GetConfig().Startup.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	slots := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			m.start(dynamicClient, target.key.gvr, target.kind, target.key.namespace)
+		}()
+	}
+	wg.Wait()
+}
+
+// start runs the informer for gvr in namespace and blocks until its cache has
+// synced. Concurrent callers for the same key wait on the same informer.
+func (m *informerManager) start(dynamicClient dynamic.Interface, gvr schema.GroupVersionResource, kind string, namespace string) {
+	key := informerKey{gvr: gvr, namespace: namespace}
+
+	m.mu.Lock()
+	if m.ctx.Err() != nil {
+		m.mu.Unlock()
+		return
+	}
+	if existing, exists := m.informers[key]; exists {
+		m.mu.Unlock()
+		existing.lastUsed.Store(time.Now().UnixNano())
+		select {
+		case <-existing.synced:
+		case <-existing.ctx.Done():
+		}
+		return
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	entry := &managedInformer{
+		key:       key,
+		kind:      kind,
+		selectors: m.kubefs.listSelectors(gvr, kind, namespace == ""),
+		ctx:       ctx,
+		cancel:    cancel,
+		synced:    make(chan struct{}),
+	}
+	entry.lastUsed.Store(time.Now().UnixNano())
+	// The informer is built before the entry is published, as teardown reads
+	// it from other goroutines.
+	entry.informer = m.newInformer(dynamicClient, gvr, namespace, entry.selectors.tweak())
+	if err := entry.informer.SetTransform(stripManagedFields); err != nil {
+		Warnf("Failed to set transform for %s: %v", gvr.String(), err)
+	}
+	entry.informer.AddEventHandler(m.eventHandler(entry))
+	m.informers[key] = entry
+	m.status[key] = syncStatus{state: syncStatePending}
+	m.mu.Unlock()
+
+	Infof("Adding dynamic informer for resource: %s (Kind: %s, Namespace: %s)", gvr.String(), kind, namespace)
+
+	go entry.informer.RunWithContext(ctx)
+
+	syncCtx := ctx
+	timeout := m.kubefs.GetConfig().Startup.SyncTimeout.Duration
+	if timeout > 0 {
+		var cancelSync context.CancelFunc
+		syncCtx, cancelSync = context.WithTimeout(ctx, timeout)
+		defer cancelSync()
+	}
+	if !cache.WaitForCacheSync(syncCtx.Done(), entry.informer.HasSynced) {
+		detail := "stopped before cache sync"
+		if ctx.Err() == nil {
+			detail = "timed out after " + timeout.String()
+		}
+		Errorf("Failed to sync informer cache for GVR: %s (%s)", gvr.String(), detail)
+		m.stopFailed(entry, detail)
+		m.logProgress()
+		return
+	}
+	m.markSynced(entry)
+	close(entry.synced)
+	m.logProgress()
+}
+
+// markSynced records that entry synced, unless it was stopped meanwhile.
+func (m *informerManager) markSynced(entry *managedInformer) {
+	m.mu.Lock()
+	if m.informers[entry.key] == entry {
+		m.status[entry.key] = syncStatus{state: syncStateSynced}
+	}
+	m.mu.Unlock()
+}
+
+func (m *informerManager) counts() (synced int, pending int, failed int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, status := range m.status {
+		switch status.state {
+		case syncStateSynced:
+			synced++
+		case syncStatePending:
+			pending++
+		case syncStateFailed:
+			failed++
+		}
+	}
+	return synced, pending, failed
+}
+
+func (m *informerManager) logProgress() {
+	synced, pending, failed := m.counts()
+	Infof("Informer sync progress: %d synced, %d pending, %d failed", synced, pending, failed)
+}
+
+// syncReport renders the content of the /.kubefs/sync status file.
+func (m *informerManager) syncReport() []byte {
+	synced, pending, failed := m.counts()
+
+	m.mu.Lock()
+	lines := make([]string, 0, len(m.status))
+	for key, status := range m.status {
+		namespace := key.namespace
+		if namespace == "" {
+			namespace = "*"
+		}
+		line := fmt.Sprintf("%-8s %s %s", status.state, gvrPath(key.gvr), namespace)
+		if status.detail != "" {
+			line += " " + status.detail
+		}
+		lines = append(lines, line)
+	}
+	m.mu.Unlock()
+	sort.Strings(lines)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "synced: %d pending: %d failed: %d\n", synced, pending, failed)
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func gvrPath(gvr schema.GroupVersionResource) string {
+	if gvr.Group == "" {
+		return gvr.Version + "/" + gvr.Resource
+	}
+	return gvr.Group + "/" + gvr.Version + "/" + gvr.Resource
+}
+
+// newInformer builds a metadata-only informer when configured, which is all the
+// tree needs; full objects are fetched from the API server on open.
+func (m *informerManager) newInformer(dynamicClient dynamic.Interface, gvr schema.GroupVersionResource, namespace string, tweak func(*metav1.ListOptions)) cache.SharedIndexInformer {
+	if m.kubefs.GetConfig().MetadataOnly && m.kubefs.MetadataClient != nil {
+		return metadatainformer.NewFilteredMetadataInformer(
+			m.kubefs.MetadataClient,
+			gvr,
+			namespace,
+			time.Minute*5, // Resync period
+			cache.Indexers{},
+			tweak,
+		).Informer()
+	}
+	return dynamicinformer.NewFilteredDynamicInformer(
+		dynamicClient,
+		gvr,
+		namespace,
+		time.Minute*5, // Resync period
+		cache.Indexers{},
+		tweak,
+	).Informer()
+}
+
+// stripManagedFields drops managedFields before objects enter the informer
+// cache; they are never needed to maintain the tree.
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if object, err := meta.Accessor(obj); err == nil {
+		object.SetManagedFields(nil)
+	}
+	return obj, nil
+}
+
+// ensureForNamespace starts every lazily registered informer that feeds the
+// given namespace directory.
+func (m *informerManager) ensureForNamespace(ns *Namespace) {
+	m.ensure(func(key informerKey, target lazyTarget) bool {
+		return m.targetFeeds(key, target, ns)
+	})
+}
+
+// ensureForFile starts the lazily registered informer that would provide the
+// named file in the given namespace directory, if any.
+func (m *informerManager) ensureForFile(ns *Namespace, filename string) {
+	_, kind, group, version, ok := parseResourceFilename(filename)
+	if !ok {
+		return
+	}
+	m.ensure(func(key informerKey, target lazyTarget) bool {
+		if key.gvr.Group != group || key.gvr.Version != version || !strings.EqualFold(target.kind, kind) {
+			return false
+		}
+		return m.targetFeeds(key, target, ns)
+	})
+}
+
+func (m *informerManager) targetFeeds(key informerKey, target lazyTarget, ns *Namespace) bool {
+	if ns.Clusterwide {
+		return !target.namespaced
+	}
+	return target.namespaced && (key.namespace == "" || key.namespace == ns.Name)
+}
+
+func (m *informerManager) ensure(match func(informerKey, lazyTarget) bool) {
+	if !m.kubefs.GetConfig().Lazy.Enabled || m.kubefs.DynamicClient == nil {
+		return
+	}
+
+	m.mu.Lock()
+	targets := make([]informerTarget, 0)
+	for key, target := range m.lazy {
+		if match(key, target) && m.kubefs.allowsType(key.gvr, target.kind, !target.namespaced) {
+			targets = append(targets, informerTarget{key: key, kind: target.kind, namespaced: target.namespaced})
+		}
+	}
+	m.mu.Unlock()
+
+	m.startAll(m.kubefs.DynamicClient, targets)
+}
+
+// runIdleReaper stops lazily started informers that have not been used for
+// longer than the configured idle timeout.
+func (m *informerManager) runIdleReaper() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		lazy := m.kubefs.GetConfig().Lazy
+		if !lazy.Enabled || lazy.IdleTimeout.Duration == 0 {
+			continue
+		}
+		deadline := time.Now().Add(-lazy.IdleTimeout.Duration).UnixNano()
+		for _, entry := range m.idle(deadline) {
+			Infof("Stopping idle informer for resource: %s (Namespace: %s)", entry.key.gvr.String(), entry.key.namespace)
+			m.stop(entry.key)
+		}
+	}
+}
+
+func (m *informerManager) idle(deadline int64) []*managedInformer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]*managedInformer, 0)
+	for key, entry := range m.informers {
+		if _, lazy := m.lazy[key]; !lazy {
+			continue
+		}
+		if entry.lastUsed.Load() < deadline {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+func (m *informerManager) eventHandler(entry *managedInformer) cache.ResourceEventHandler {
+	kubefs := m.kubefs
+	gvr := entry.key.gvr
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if entry.ctx.Err() != nil {
+				return
+			}
+			object, err := meta.Accessor(obj)
+			if err != nil {
+				Errorf("Error decoding resource: %v", err)
+				return
+			}
+			Debugf("Resource added [%s]: %s/%s", gvr.String(), object.GetNamespace(), object.GetName())
+
+			kubefs.syncObject(context.Background(), gvr, entry.gvk(), object)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if entry.ctx.Err() != nil {
+				return
+			}
+			object, err := meta.Accessor(newObj)
+			if err != nil {
+				Errorf("Error decoding resource: %v", err)
+				return
+			}
+
+			kubefs.syncObject(context.Background(), gvr, entry.gvk(), object)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if entry.ctx.Err() != nil {
+				return
+			}
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			object, err := meta.Accessor(obj)
+			if err != nil {
+				Errorf("Error decoding resource tombstone: %v", err)
+				return
+			}
+			Debugf("Resource deleted [%s]: %s/%s", gvr.String(), object.GetNamespace(), object.GetName())
+
+			kubefs.DeleteResource(context.Background(), object.GetName(), gvr.Resource, object.GetNamespace(), entry.gvk())
+		},
+	}
+}
+
+// stop cancels the informer for key and removes every file it produced,
+// along with its sync status, including the failure of an earlier attempt.
+func (m *informerManager) stop(key informerKey) {
+	m.mu.Lock()
+	entry, exists := m.informers[key]
+	delete(m.informers, key)
+	delete(m.status, key)
+	m.mu.Unlock()
+	if !exists {
+		return
+	}
+	m.teardown(entry)
+}
+
+// stopFailed stops an informer that did not sync. Its failure stays in the
+// sync status until the next attempt to start it, or until it is stopped for
+// good.
+func (m *informerManager) stopFailed(entry *managedInformer, detail string) {
+	m.mu.Lock()
+	current := m.informers[entry.key] == entry
+	if current {
+		delete(m.informers, entry.key)
+		m.status[entry.key] = syncStatus{state: syncStateFailed, detail: detail}
+	}
+	m.mu.Unlock()
+	if current {
+		m.teardown(entry)
+	}
+}
+
+func (m *informerManager) teardown(entry *managedInformer) {
+	key := entry.key
+	Infof("Stopping dynamic informer for resource: %s (Namespace: %s)", key.gvr.String(), key.namespace)
+	entry.cancel()
+	if entry.informer == nil {
+		return
+	}
+	for _, obj := range entry.informer.GetStore().List() {
+		object, err := meta.Accessor(obj)
+		if err != nil {
+			continue
+		}
+		m.kubefs.removeResourceFile(object.GetName(), object.GetNamespace(), entry.gvk())
+	}
+}
+
+// stopGVR stops every informer for gvr and forgets any lazy registration,
+// which is what a removed CRD needs.
+func (m *informerManager) stopGVR(gvr schema.GroupVersionResource) {
+	m.mu.Lock()
+	for key := range m.lazy {
+		if key.gvr == gvr {
+			delete(m.lazy, key)
+		}
+	}
+	for key := range m.status {
+		if key.gvr == gvr {
+			delete(m.status, key)
+		}
+	}
+	m.mu.Unlock()
+	for _, key := range m.keys() {
+		if key.gvr == gvr {
+			m.stop(key)
+		}
+	}
+}
+
+// stopDenied stops informers whose resource or namespace is no longer
+// allowed by the current configuration, or that do not fit its scope: in
+// namespace scope every informer is per namespace, while in cluster scope
+// they all watch every namespace. Informers listing with outdated selectors
+// are stopped too, so discovery restarts them with the current ones.
+func (m *informerManager) stopDenied() {
+	clusterScope := m.kubefs.IsClusterScope()
+	fits := func(key informerKey, kind string) bool {
+		if !m.kubefs.allowsType(key.gvr, kind, key.namespace == "") {
+			return false
+		}
+		if clusterScope || key.namespace == "" {
+			return key.namespace == ""
+		}
+		return m.kubefs.AllowsNamespace(key.namespace)
+	}
+
+	m.mu.Lock()
+	for key, target := range m.lazy {
+		if !fits(key, target.kind) {
+			delete(m.lazy, key)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, entry := range m.entries() {
+		if !fits(entry.key, entry.kind) || entry.selectors != m.kubefs.listSelectors(entry.key.gvr, entry.kind, entry.key.namespace == "") {
+			m.stop(entry.key)
+		}
+	}
+}
+
+// refilter re-applies the object filters to every cached object, adding and
+// removing files for objects whose filter result changed.
+func (m *informerManager) refilter() {
+	for _, entry := range m.entries() {
+		select {
+		case <-entry.synced:
+		default:
+			continue
+		}
+		for _, obj := range entry.informer.GetStore().List() {
+			object, err := meta.Accessor(obj)
+			if err != nil {
+				continue
+			}
+			m.kubefs.syncObject(context.Background(), entry.key.gvr, entry.gvk(), object)
+		}
+	}
+}
+
+func (m *informerManager) entries() []*managedInformer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := make([]*managedInformer, 0, len(m.informers))
+	for _, entry := range m.informers {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (m *informerManager) keys() []informerKey {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]informerKey, 0, len(m.informers))
+	for key := range m.informers {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// shutdown stops every informer, including the namespace and CRD informers
+// that share the manager context.
+func (m *informerManager) shutdown() {
+	m.cancel()
+	m.mu.Lock()
+	m.informers = make(map[informerKey]*managedInformer)
+	m.status = make(map[informerKey]syncStatus)
+	m.mu.Unlock()
+}
@@ -0,0 +1,273 @@
+package kubefs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func addTestInformer(m *informerManager, gvr schema.GroupVersionResource, namespace string) *managedInformer {
+	ctx, cancel := context.WithCancel(m.ctx)
+	entry := &managedInformer{
+		key:    informerKey{gvr: gvr, namespace: namespace},
+		kind:   "Test",
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	m.informers[entry.key] = entry
+	return entry
+}
+
+func TestInformerManager_StopDenied(t *testing.T) {
+	kfs := NewKubeFS(Config{
+		Scope:      ScopeNamespace,
+		Namespaces: []string{"dev"},
+		DenyRules:  []FilterRule{{ApiGroups: []string{"core"}, Resources: []string{"secrets"}}},
+	})
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	secrets := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+	kept := addTestInformer(kfs.informers, pods, "dev")
+	deniedResource := addTestInformer(kfs.informers, secrets, "dev")
+	deniedNamespace := addTestInformer(kfs.informers, pods, "qa")
+
+	kfs.informers.stopDenied()
+
+	if kept.ctx.Err() != nil {
+		t.Fatalf("expected allowed informer to keep running")
+	}
+	if deniedResource.ctx.Err() == nil || deniedNamespace.ctx.Err() == nil {
+		t.Fatalf("expected denied informers to be cancelled")
+	}
+	if keys := kfs.informers.keys(); len(keys) != 1 || keys[0] != kept.key {
+		t.Fatalf("unexpected remaining informers: %v", keys)
+	}
+}
+
+func TestInformerManager_Shutdown(t *testing.T) {
+	kfs := NewKubeFS(Config{Scope: ScopeCluster})
+	entry := addTestInformer(kfs.informers, schema.GroupVersionResource{Version: "v1", Resource: "pods"}, "")
+
+	kfs.Shutdown()
+
+	if entry.ctx.Err() == nil {
+		t.Fatalf("expected informer context to be cancelled on shutdown")
+	}
+	select {
+	case <-kfs.informers.Done():
+	default:
+		t.Fatalf("expected manager to be done after shutdown")
+	}
+}
+
+func TestInformerManager_TargetFeeds(t *testing.T) {
+	m := NewKubeFS(Config{Scope: ScopeCluster}).informers
+	pods := informerKey{gvr: schema.GroupVersionResource{Version: "v1", Resource: "pods"}}
+	nodes := informerKey{gvr: schema.GroupVersionResource{Version: "v1", Resource: "nodes"}}
+	devPods := informerKey{gvr: pods.gvr, namespace: "dev"}
+
+	clusterwide := &Namespace{Name: "clusterwide", Clusterwide: true}
+	dev := &Namespace{Name: "dev"}
+	qa := &Namespace{Name: "qa"}
+
+	if !m.targetFeeds(pods, lazyTarget{namespaced: true}, dev) {
+		t.Fatalf("expected all-namespace pods to feed dev")
+	}
+	if m.targetFeeds(pods, lazyTarget{namespaced: true}, clusterwide) {
+		t.Fatalf("expected pods not to feed clusterwide")
+	}
+	if !m.targetFeeds(nodes, lazyTarget{namespaced: false}, clusterwide) {
+		t.Fatalf("expected nodes to feed clusterwide")
+	}
+	if m.targetFeeds(devPods, lazyTarget{namespaced: true}, qa) {
+		t.Fatalf("expected dev pods not to feed qa")
+	}
+}
+
+func TestInformerManager_IdleOnlyReturnsLazyInformers(t *testing.T) {
+	m := NewKubeFS(Config{Scope: ScopeCluster}).informers
+	lazy := addTestInformer(m, schema.GroupVersionResource{Version: "v1", Resource: "pods"}, "")
+	eager := addTestInformer(m, schema.GroupVersionResource{Version: "v1", Resource: "services"}, "")
+	m.lazy[lazy.key] = lazyTarget{kind: "Pod", namespaced: true}
+	lazy.lastUsed.Store(1)
+	eager.lastUsed.Store(1)
+
+	idle := m.idle(2)
+	if len(idle) != 1 || idle[0] != lazy {
+		t.Fatalf("expected only the lazy informer to be idle, got %v", idle)
+	}
+}
+
+func TestStripManagedFields(t *testing.T) {
+	full := &unstructured.Unstructured{}
+	full.SetName("web")
+	full.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: "kubectl"}})
+	partial := &metav1.PartialObjectMetadata{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:          "web",
+			ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+		},
+	}
+
+	for _, obj := range []metav1.Object{full, partial} {
+		if _, err := stripManagedFields(obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(obj.GetManagedFields()) != 0 {
+			t.Fatalf("expected managedFields to be stripped from %T", obj)
+		}
+		if obj.GetName() != "web" {
+			t.Fatalf("expected name to be preserved on %T", obj)
+		}
+	}
+}
+
+func TestInformerManager_SyncReport(t *testing.T) {
+	m := NewKubeFS(Config{Scope: ScopeCluster}).informers
+	deployments := informerKey{gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}}
+	pods := informerKey{gvr: schema.GroupVersionResource{Version: "v1", Resource: "pods"}, namespace: "dev"}
+	metrics := informerKey{gvr: schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}}
+	m.status[deployments] = syncStatus{state: syncStateSynced}
+	m.status[pods] = syncStatus{state: syncStatePending}
+	m.status[metrics] = syncStatus{state: syncStateFailed, detail: "timed out after 1m0s"}
+
+	expected := "" +
+		"synced: 1 pending: 1 failed: 1\n" +
+		"failed   metrics.k8s.io/v1beta1/pods * timed out after 1m0s\n" +
+		"pending  v1/pods dev\n" +
+		"synced   apps/v1/deployments *\n"
+	if report := string(m.syncReport()); report != expected {
+		t.Fatalf("unexpected report:\n%s", report)
+	}
+}
+
+func TestInformerManager_ReconcileDiscovered(t *testing.T) {
+	kfs := NewKubeFS(Config{Scope: ScopeCluster, Lazy: LazyConfig{Enabled: true}})
+	m := kfs.informers
+	pods := informerTarget{key: informerKey{gvr: schema.GroupVersionResource{Version: "v1", Resource: "pods"}}, kind: "Pod", namespaced: true}
+	metrics := informerTarget{key: informerKey{gvr: schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}}, kind: "PodMetrics", namespaced: true}
+	custom := informerTarget{key: informerKey{gvr: schema.GroupVersionResource{Group: "custom.example.com", Version: "v1", Resource: "widgets"}}, kind: "Widget", namespaced: true}
+
+	m.reconcileDiscovered(nil, []informerTarget{pods, metrics, custom}, nil)
+	if len(m.lazy) != 3 {
+		t.Fatalf("expected 3 registered informers, got %d", len(m.lazy))
+	}
+
+	failed := map[schema.GroupVersion]bool{custom.key.gvr.GroupVersion(): true}
+	m.reconcileDiscovered(nil, []informerTarget{pods}, failed)
+
+	if _, ok := m.lazy[pods.key]; !ok {
+		t.Fatalf("expected pods to stay registered")
+	}
+	if _, ok := m.lazy[metrics.key]; ok {
+		t.Fatalf("expected removed API to be unregistered")
+	}
+	if _, ok := m.lazy[custom.key]; !ok {
+		t.Fatalf("expected API with failed discovery to be kept")
+	}
+}
+
+func TestInformerManager_StopDeniedFollowsScope(t *testing.T) {
+	kfs := NewKubeFS(Config{Scope: ScopeCluster})
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+	clusterwide := addTestInformer(kfs.informers, pods, "")
+	perNamespace := addTestInformer(kfs.informers, pods, "dev")
+	kfs.informers.stopDenied()
+
+	if clusterwide.ctx.Err() != nil {
+		t.Fatalf("expected all-namespace informer to keep running in cluster scope")
+	}
+	if perNamespace.ctx.Err() == nil {
+		t.Fatalf("expected per-namespace informer to stop in cluster scope")
+	}
+
+	kfs.SetConfig(Config{Scope: ScopeNamespace, Namespaces: []string{"dev"}})
+	kfs.informers.stopDenied()
+	if clusterwide.ctx.Err() == nil {
+		t.Fatalf("expected all-namespace informer to stop in namespace scope")
+	}
+}
+
+func TestInformerManager_FailedStatusUntilNextAttempt(t *testing.T) {
+	kfs := NewKubeFS(Config{Scope: ScopeCluster, Lazy: LazyConfig{Enabled: true}})
+	m := kfs.informers
+	pods := informerTarget{key: informerKey{gvr: schema.GroupVersionResource{Version: "v1", Resource: "pods"}}, kind: "Pod", namespaced: true}
+
+	failed := addTestInformer(m, pods.key.gvr, "")
+	m.stopFailed(failed, "timed out after 1s")
+	if failed.ctx.Err() == nil || len(m.keys()) != 0 {
+		t.Fatalf("expected the informer to be stopped")
+	}
+	if status := m.status[pods.key]; status.state != syncStateFailed {
+		t.Fatalf("expected the failure to be reported, got %+v", status)
+	}
+
+	// A retry replaces the failure, and a late report of the old attempt
+	// does not overwrite it.
+	retry := addTestInformer(m, pods.key.gvr, "")
+	m.status[pods.key] = syncStatus{state: syncStatePending}
+	m.stopFailed(failed, "timed out after 1s")
+	if status := m.status[pods.key]; status.state != syncStatePending || retry.ctx.Err() != nil {
+		t.Fatalf("expected the retry to be left alone, got %+v", status)
+	}
+	m.stop(pods.key)
+	m.status[pods.key] = syncStatus{state: syncStateFailed, detail: "timed out after 1s"}
+
+	// Once the API is gone the failed entry goes with it.
+	m.reconcileDiscovered(nil, []informerTarget{pods}, nil)
+	m.reconcileDiscovered(nil, nil, nil)
+	if _, ok := m.status[pods.key]; ok {
+		t.Fatalf("expected the failed status to be cleared, got %s", m.syncReport())
+	}
+}
+
+func TestAddCRDInformer_QueuesStartup(t *testing.T) {
+	widgets := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	kfs := NewKubeFS(Config{Scope: ScopeCluster, Startup: StartupConfig{Workers: 2}})
+	defer kfs.Shutdown()
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{widgets: "WidgetList"})
+	release := make(chan struct{})
+	client.PrependReactor("list", "widgets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		<-release
+		return false, nil, nil
+	})
+	crd := &apiextensionsv1.CustomResourceDefinition{Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+		Group: "example.com",
+		Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "widgets", Kind: "Widget"},
+		Scope: apiextensionsv1.NamespaceScoped,
+		Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+			{Name: "v1", Served: true, Storage: true},
+		},
+	}}
+
+	// The handler returns while the list is still blocked.
+	addCRDInformer(client, crd, kfs)
+	waitForSyncState(t, kfs.informers, informerKey{gvr: widgets}, syncStatePending)
+	close(release)
+	waitForSyncState(t, kfs.informers, informerKey{gvr: widgets}, syncStateSynced)
+}
+
+func waitForSyncState(t *testing.T, m *informerManager, key informerKey, state string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		current := m.status[key].state
+		m.mu.Unlock()
+		if current == state {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %v to be %s, got %s", key, state, m.syncReport())
+}
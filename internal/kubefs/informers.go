@@ -3,15 +3,14 @@ package kubefs
 import (
 	"context"
 	"os"
-	"strings"
 	"time"
 
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/openapi/cached"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
@@ -24,17 +23,6 @@ import (
 	apiextensionsinformers "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions"
 )
 
-type informerKey struct {
-	gvr       schema.GroupVersionResource
-	namespace string
-}
-
-// A map to keep track of active informers for all resources
-var activeInformers = make(map[informerKey]cache.SharedInformer)
-
-// Stop channel for all informers
-var stopCh chan struct{}
-
 func Inform(kubefs *KubeFS) {
 	// Load Kubernetes configuration
 	config, err := rest.InClusterConfig()
@@ -49,53 +37,16 @@ func Inform(kubefs *KubeFS) {
 		}
 	}
 
-	// Create a Kubernetes clientset for standard resources (used for CRD informer)
+	kubefs.cluster = config.Host
+
+	// Create a Kubernetes clientset for standard resources (used for namespace informer)
 	kubeClient, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		Fatalf("Error creating kubernetes clientset: %v", err)
 	}
 	kubefs.DiscoveryClient = kubeClient.Discovery()
-
-	// Load namespaces and watch for namespace changes
-	var namespaceInformer cache.SharedInformer
-	var namespaceInformerFactory informers.SharedInformerFactory
-	if kubefs.IsClusterScope() {
-		namespaceInformerFactory = informers.NewSharedInformerFactory(kubeClient, time.Second*30)
-		namespaceInformer = namespaceInformerFactory.Core().V1().Namespaces().Informer()
-
-		namespaceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-			AddFunc: func(obj interface{}) {
-				ns := obj.(*corev1.Namespace)
-				Debugf("Namespace added: %s", ns.Name)
-				kubefs.AddNamespace(context.Background(), ns.Name, false)
-			},
-			UpdateFunc: func(oldObj, newObj interface{}) {
-				oldNs := oldObj.(*corev1.Namespace)
-				newNs := newObj.(*corev1.Namespace)
-				if oldNs.ResourceVersion != newNs.ResourceVersion {
-					Debugf("Namespace updated: %s (resourceVersion: %s -> %s)", newNs.Name, oldNs.ResourceVersion, newNs.ResourceVersion)
-					// For simplicity, we treat updates as no-ops for now. In production, you might want to handle status changes or labels that affect visibility.
-				}
-			},
-			DeleteFunc: func(obj interface{}) {
-				ns, ok := obj.(*corev1.Namespace)
-				if !ok {
-					tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
-					if !ok {
-						Errorf("Error decoding namespace, invalid type")
-						return
-					}
-					ns, ok = tombstone.Obj.(*corev1.Namespace)
-					if !ok {
-						Errorf("Error decoding namespace tombstone, invalid type")
-						return
-					}
-				}
-				Debugf("Namespace deleted: %s", ns.Name)
-				kubefs.RemoveNamespace(context.Background(), ns.Name)
-			},
-		})
-	}
+	kubefs.openAPIClient = cached.NewClient(kubeClient.Discovery().OpenAPIV3())
+	kubefs.kubeClient = kubeClient
 
 	// Create a dynamic client for custom resources
 	dynamicClient, err := dynamic.NewForConfig(config)
@@ -105,277 +56,295 @@ func Inform(kubefs *KubeFS) {
 
 	kubefs.DynamicClient = dynamicClient
 
-	var crdInformer cache.SharedInformer
-	if kubefs.IsClusterScope() {
-		// Create an apiextensions clientset for CRDs
-		apiextensionsClient, err := apiextensionsclientset.NewForConfig(config)
-		if err != nil {
-			Fatalf("Error creating apiextensions clientset: %v", err)
-		}
-
-		// Create a shared informer factory for apiextensions (specifically for CRDs)
-		apiextensionsInformerFactory := apiextensionsinformers.NewSharedInformerFactory(apiextensionsClient, time.Second*30)
-		crdInformer = apiextensionsInformerFactory.Apiextensions().V1().CustomResourceDefinitions().Informer()
-
-		// Register event handlers for CRD additions and deletions
-		crdInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-			AddFunc: func(obj interface{}) {
-				crd := obj.(*apiextensionsv1.CustomResourceDefinition)
-				Debugf("CRD added: %s", crd.Name)
-				addCRDInformer(dynamicClient, crd, kubefs)
-			},
-			UpdateFunc: func(oldObj, newObj interface{}) {
-				oldCrd := oldObj.(*apiextensionsv1.CustomResourceDefinition)
-				newCrd := newObj.(*apiextensionsv1.CustomResourceDefinition)
-				// Only re-add if spec changes, which might affect GVRs or validation
-				if oldCrd.ResourceVersion != newCrd.ResourceVersion {
-					Debugf("CRD updated: %s (resourceVersion: %s -> %s)", newCrd.Name, oldCrd.ResourceVersion, newCrd.ResourceVersion)
-					// For simplicity, we stop the old and start a new. In production, careful diffing is needed.
-					removeCRDInformer(oldCrd)
-					addCRDInformer(dynamicClient, newCrd, kubefs)
-				}
-			},
-			DeleteFunc: func(obj interface{}) {
-				crd, ok := obj.(*apiextensionsv1.CustomResourceDefinition)
-				if !ok {
-					tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
-					if !ok {
-						Errorf("Error decoding CRD, invalid type")
-						return
-					}
-					crd, ok = tombstone.Obj.(*apiextensionsv1.CustomResourceDefinition)
-					if !ok {
-						Errorf("Error decoding CRD tombstone, invalid type")
-						return
-					}
-				}
-				Debugf("CRD deleted: %s", crd.Name)
-				removeCRDInformer(crd)
-			},
-		})
-
-		Infof("Starting CRD informer...")
-		apiextensionsInformerFactory.Start(stopCh)
-	}
-	if namespaceInformerFactory != nil {
-		namespaceInformerFactory.Start(stopCh)
+	// Create a metadata client for metadata-only informers
+	metadataClient, err := metadata.NewForConfig(config)
+	if err != nil {
+		Fatalf("Error creating metadata client: %v", err)
 	}
-	if crdInformer != nil || namespaceInformer != nil {
-		if !cache.WaitForCacheSync(stopCh, informerSynced(crdInformer, namespaceInformer)...) {
-			Fatalf("Failed to sync informer cache")
-		}
+	kubefs.MetadataClient = metadataClient
+
+	// Create an apiextensions clientset for CRDs
+	apiextensionsClient, err := apiextensionsclientset.NewForConfig(config)
+	if err != nil {
+		Fatalf("Error creating apiextensions clientset: %v", err)
 	}
+	kubefs.apiextensionsClient = apiextensionsClient
+
+	startScopeInformers(kubefs)
 	Infof("Informers synced. Discovering server resources...")
 
 	// Discover all server resources (native + CRDs)
-	discoverResources(kubeClient, dynamicClient, kubefs)
+	discoverResources(kubefs.DiscoveryClient, dynamicClient, kubefs)
+	go kubefs.informers.runIdleReaper()
+	go runDiscoveryRefresher(dynamicClient, kubefs)
+	go kubefs.runNamespaceChecker()
 }
 
-func addCRDInformer(dynamicClient dynamic.Interface, crd *apiextensionsv1.CustomResourceDefinition, kubefs *KubeFS) {
-	// CRDs can define multiple versions, we need to pick one or handle all.
-	// For simplicity, we'll iterate through all versions and create an informer for each.
-	// In a production scenario, you might only care about the storage version or latest stable version.
-	for _, version := range crd.Spec.Versions {
-		if !version.Storage || !version.Served {
-			continue // Only add informers for served versions that are marked as storage (or you could choose differently based on your needs)
-		}
-
-		gvr := schema.GroupVersionResource{
-			Group:    crd.Spec.Group,
-			Version:  version.Name,
-			Resource: crd.Spec.Names.Plural,
-		}
-
-		addInformersForScope(dynamicClient, gvr, crd.Spec.Names.Kind, kubefs, crd.Spec.Scope)
-	}
+// scopeInformers are the namespace and CRD informers that only run in
+// cluster scope, or the namespace informer used to select namespaces by
+// pattern or label in namespace scope. They are restarted when the scope or
+// namespace selection changes at runtime.
+type scopeInformers struct {
+	cancel            context.CancelFunc
+	crdInformer       cache.SharedInformer
+	namespaceInformer cache.SharedInformer
 }
 
-func removeCRDInformer(crd *apiextensionsv1.CustomResourceDefinition) {
-	for _, version := range crd.Spec.Versions {
-		gvr := schema.GroupVersionResource{
-			Group:    crd.Spec.Group,
-			Version:  version.Name,
-			Resource: crd.Spec.Names.Plural,
-		}
+func startScopeInformers(kubefs *KubeFS) {
+	kubefs.scopeMu.Lock()
+	defer kubefs.scopeMu.Unlock()
 
-		for _, key := range informerKeysForGVR(gvr) {
-			Warnf("Stopping and removing dynamic informer for custom resource: %s", gvr.String())
-			// This is tricky. There's no direct "Stop" method on cache.SharedInformer
-			// or dynamicinformer.DynamicSharedInformerFactory for individual informers.
-			// The stopCh passed to factory.Start() stops ALL informers in that factory.
-			// For a true dynamic removal, you'd need a factory per GVR and manage their stop channels individually.
-			// For this example, we'll mark it as inactive and rely on the main stopCh.
-			// A more robust solution might involve canceling the context used to start the individual informer.
-			delete(activeInformers, key)
-			Warnf("Informer for %s marked for removal. Actual goroutine might persist until main stopCh closes.", gvr.String())
-		}
+	if kubefs.scope != nil {
+		kubefs.scope.cancel()
+		kubefs.scope = nil
 	}
-}
-
-func addInformer(dynamicClient dynamic.Interface, gvr schema.GroupVersionResource, kind string, kubefs *KubeFS, namespace string) {
-	key := informerKey{gvr: gvr, namespace: namespace}
-	if _, exists := activeInformers[key]; exists {
+	if kubefs.UsesNamespaceInformer() {
+		startNamespaceSelection(kubefs)
+		return
+	}
+	if !kubefs.IsClusterScope() {
 		return
 	}
 
-	Infof("Adding dynamic informer for resource: %s (Kind: %s, Namespace: %s)", gvr.String(), kind, namespace)
-
-	// Create a DynamicSharedInformerFactory for this specific GVR
-	dynamicInformerFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(
-		dynamicClient,
-		time.Minute*5, // Resync period
-		namespace,
-		nil, // TweakListOptionsFunc (optional)
-	)
+	ctx, cancel := context.WithCancel(kubefs.informers.ctx)
+	scope := &scopeInformers{cancel: cancel}
 
-	// Get the informer for the specific GVR
-	informer := dynamicInformerFactory.ForResource(gvr).Informer()
+	// Load namespaces and watch for namespace changes
+	namespaceInformerFactory := informers.NewSharedInformerFactory(kubefs.kubeClient, time.Second*30)
+	namespaceInformer := namespaceInformerFactory.Core().V1().Namespaces().Informer()
 
-	// Add event handlers
-	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	namespaceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			unstructuredObj := obj.(*unstructured.Unstructured)
-			Debugf("Resource added [%s]: %s/%s", gvr.String(), unstructuredObj.GetNamespace(), unstructuredObj.GetName())
-
-			kubefs.AddResource(context.Background(), unstructuredObj.GetName(), gvr.Resource, unstructuredObj.GetNamespace(), schema.GroupVersionKind{
-				Group:   gvr.Group,
-				Version: gvr.Version,
-				Kind:    kind,
-			})
+			ns := obj.(*corev1.Namespace)
+			Debugf("Namespace added: %s", ns.Name)
+			kubefs.AddNamespace(context.Background(), ns.Name, false)
+			kubefs.SetNamespacePhase(context.Background(), ns.Name, string(ns.Status.Phase))
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
-			oldUnstructuredObj := oldObj.(*unstructured.Unstructured)
-			newUnstructuredObj := newObj.(*unstructured.Unstructured)
-			if oldUnstructuredObj.GetResourceVersion() != newUnstructuredObj.GetResourceVersion() {
-				// klog.V(4).Infof("Resource UPDATED [%s]: %s/%s", gvr.String(), newUnstructuredObj.GetNamespace(), newUnstructuredObj.GetName())
+			oldNs := oldObj.(*corev1.Namespace)
+			newNs := newObj.(*corev1.Namespace)
+			if oldNs.ResourceVersion != newNs.ResourceVersion {
+				Debugf("Namespace updated: %s (resourceVersion: %s -> %s)", newNs.Name, oldNs.ResourceVersion, newNs.ResourceVersion)
+				kubefs.SetNamespacePhase(context.Background(), newNs.Name, string(newNs.Status.Phase))
 			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			ns := namespaceFromDelete(obj)
+			if ns == nil {
+				return
+			}
+			Debugf("Namespace deleted: %s", ns.Name)
+			kubefs.RemoveNamespace(context.Background(), ns.Name)
+		},
+	})
+
+	// Create a shared informer factory for apiextensions (specifically for CRDs)
+	dynamicClient := kubefs.DynamicClient
+	apiextensionsInformerFactory := apiextensionsinformers.NewSharedInformerFactory(kubefs.apiextensionsClient, time.Second*30)
+	scope.crdInformer = apiextensionsInformerFactory.Apiextensions().V1().CustomResourceDefinitions().Informer()
 
-			kubefs.AddResource(context.Background(), newUnstructuredObj.GetName(), gvr.Resource, newUnstructuredObj.GetNamespace(), schema.GroupVersionKind{
-				Group:   gvr.Group,
-				Version: gvr.Version,
-				Kind:    kind,
-			})
+	// Register event handlers for CRD additions and deletions
+	scope.crdInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			crd := obj.(*apiextensionsv1.CustomResourceDefinition)
+			Debugf("CRD added: %s", crd.Name)
+			addCRDInformer(dynamicClient, crd, kubefs)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldCrd := oldObj.(*apiextensionsv1.CustomResourceDefinition)
+			newCrd := newObj.(*apiextensionsv1.CustomResourceDefinition)
+			// Only re-add if spec changes, which might affect GVRs or validation
+			if oldCrd.ResourceVersion != newCrd.ResourceVersion {
+				Debugf("CRD updated: %s (resourceVersion: %s -> %s)", newCrd.Name, oldCrd.ResourceVersion, newCrd.ResourceVersion)
+				updateCRDInformer(dynamicClient, oldCrd, newCrd, kubefs)
+			}
 		},
 		DeleteFunc: func(obj interface{}) {
-			unstructuredObj, ok := obj.(*unstructured.Unstructured)
+			crd, ok := obj.(*apiextensionsv1.CustomResourceDefinition)
 			if !ok {
 				tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
 				if !ok {
-					Errorf("Error decoding resource, invalid type")
+					Errorf("Error decoding CRD, invalid type")
 					return
 				}
-				unstructuredObj, ok = tombstone.Obj.(*unstructured.Unstructured)
+				crd, ok = tombstone.Obj.(*apiextensionsv1.CustomResourceDefinition)
 				if !ok {
-					Errorf("Error decoding resource tombstone, invalid type")
+					Errorf("Error decoding CRD tombstone, invalid type")
 					return
 				}
 			}
-			Debugf("Resource deleted [%s]: %s/%s", gvr.String(), unstructuredObj.GetNamespace(), unstructuredObj.GetName())
+			Debugf("CRD deleted: %s", crd.Name)
+			removeCRDInformer(crd, kubefs)
+		},
+	})
 
-			kubefs.DeleteResource(context.Background(), unstructuredObj.GetName(), gvr.Resource, unstructuredObj.GetNamespace(), schema.GroupVersionKind{
-				Group:   gvr.Group,
-				Version: gvr.Version,
-				Kind:    kind,
-			})
+	Infof("Starting namespace and CRD informers...")
+	apiextensionsInformerFactory.Start(ctx.Done())
+	namespaceInformerFactory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informerSynced(scope.crdInformer, namespaceInformer)...) {
+		Warnf("Namespace and CRD informers stopped before their caches synced")
+		cancel()
+		return
+	}
+	kubefs.scope = scope
+}
+
+// startNamespaceSelection watches namespaces in namespace scope and mounts the
+// ones matching the configured patterns and namespaceSelector. The label
+// selector is sent to the API server so unrelated namespaces are not listed.
+// The caller must hold scopeMu.
+func startNamespaceSelection(kubefs *KubeFS) {
+	ctx, cancel := context.WithCancel(kubefs.informers.ctx)
+	scope := &scopeInformers{cancel: cancel}
+
+	selector := kubefs.GetConfig().NamespaceSelector
+	namespaceInformerFactory := informers.NewSharedInformerFactoryWithOptions(kubefs.kubeClient, time.Second*30,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = selector
+		}))
+	scope.namespaceInformer = namespaceInformerFactory.Core().V1().Namespaces().Informer()
+
+	scope.namespaceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			kubefs.evaluateNamespace(context.Background(), obj.(*corev1.Namespace), false)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			kubefs.evaluateNamespace(context.Background(), newObj.(*corev1.Namespace), false)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if ns := namespaceFromDelete(obj); ns != nil {
+				kubefs.evaluateNamespace(context.Background(), ns, true)
+			}
 		},
 	})
 
-	// Start the informer
-	go dynamicInformerFactory.Start(stopCh)
-	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
-		Errorf("Failed to sync informer cache for GVR: %s", gvr.String())
+	Infof("Starting namespace informer for namespace selection...")
+	namespaceInformerFactory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), scope.namespaceInformer.HasSynced) {
+		Warnf("Namespace informer stopped before its cache synced")
+		cancel()
 		return
 	}
-	activeInformers[key] = informer
+	kubefs.scope = scope
 }
 
-func discoverResources(kubeClient kubernetes.Interface, dynamicClient dynamic.Interface, kubefs *KubeFS) {
-	discoveryClient := kubeClient.Discovery()
-	resourceLists, err := discoveryClient.ServerPreferredResources()
-	if err != nil {
-		Errorf("Error discovering resources: %v", err)
+func namespaceFromDelete(obj interface{}) *corev1.Namespace {
+	ns, ok := obj.(*corev1.Namespace)
+	if ok {
+		return ns
 	}
+	tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+	if !ok {
+		Errorf("Error decoding namespace, invalid type")
+		return nil
+	}
+	ns, ok = tombstone.Obj.(*corev1.Namespace)
+	if !ok {
+		Errorf("Error decoding namespace tombstone, invalid type")
+		return nil
+	}
+	return ns
+}
 
-	config := kubefs.GetConfig()
-	namespaceList := config.Namespaces
-	if !kubefs.IsClusterScope() && len(namespaceList) == 0 {
-		Warnf("Namespace scope enabled but no namespaces configured; skipping informer setup")
+// replayCRDs re-evaluates every known CRD against the current filters so
+// CRDs that just became allowed get their informers.
+func replayCRDs(kubefs *KubeFS) {
+	kubefs.scopeMu.Lock()
+	scope := kubefs.scope
+	kubefs.scopeMu.Unlock()
+	if scope == nil || scope.crdInformer == nil {
 		return
 	}
-
-	for _, resourceList := range resourceLists {
-		groupVersion, err := schema.ParseGroupVersion(resourceList.GroupVersion)
-		if err != nil {
-			Errorf("Failed to parse GroupVersion %q: %v", resourceList.GroupVersion, err)
+	for _, obj := range scope.crdInformer.GetStore().List() {
+		crd, ok := obj.(*apiextensionsv1.CustomResourceDefinition)
+		if !ok {
 			continue
 		}
+		addCRDInformer(kubefs.DynamicClient, crd, kubefs)
+	}
+}
 
-		for _, resource := range resourceList.APIResources {
-			if !supportsListAndWatch(resource.Verbs) {
-				continue
-			}
-
-			// Skip subresources
-			if strings.Contains(resource.Name, "/") {
-				continue
-			}
-
-			if !kubefs.IsClusterScope() && !resource.Namespaced {
-				continue
-			}
+func addCRDInformer(dynamicClient dynamic.Interface, crd *apiextensionsv1.CustomResourceDefinition, kubefs *KubeFS) {
+	// CRDs can define multiple versions, we need to pick one or handle all.
+	// For simplicity, we'll iterate through all versions and create an informer for each.
+	// In a production scenario, you might only care about the storage version or latest stable version.
+	var targets []informerTarget
+	for _, version := range crd.Spec.Versions {
+		if !version.Storage || !version.Served {
+			continue // Only add informers for served versions that are marked as storage (or you could choose differently based on your needs)
+		}
 
-			gvr := schema.GroupVersionResource{
-				Group:    groupVersion.Group,
-				Version:  groupVersion.Version,
-				Resource: resource.Name,
-			}
-			if !kubefs.AllowsResource(gvr) {
-				continue
-			}
+		gvr := schema.GroupVersionResource{
+			Group:    crd.Spec.Group,
+			Version:  version.Name,
+			Resource: crd.Spec.Names.Plural,
+		}
 
-			if kubefs.IsClusterScope() {
-				addInformer(dynamicClient, gvr, resource.Kind, kubefs, metav1.NamespaceAll)
-				continue
-			}
+		targets = append(targets, informerTargetsForScope(gvr, crd.Spec.Names.Kind, kubefs, crd.Spec.Scope)...)
+	}
+	// Starting blocks until the caches sync, so it is queued to keep the CRD
+	// event handler responsive.
+	kubefs.informers.enqueue(dynamicClient, targets)
+}
 
-			for _, ns := range namespaceList {
-				addInformer(dynamicClient, gvr, resource.Kind, kubefs, ns)
-			}
+func updateCRDInformer(dynamicClient dynamic.Interface, oldCrd *apiextensionsv1.CustomResourceDefinition, newCrd *apiextensionsv1.CustomResourceDefinition, kubefs *KubeFS) {
+	current := make(map[schema.GroupVersionResource]struct{})
+	for _, gvr := range crdStorageGVRs(newCrd) {
+		current[gvr] = struct{}{}
+	}
+	for _, gvr := range crdStorageGVRs(oldCrd) {
+		if _, kept := current[gvr]; !kept {
+			kubefs.informers.stopGVR(gvr)
 		}
 	}
+	addCRDInformer(dynamicClient, newCrd, kubefs)
 }
 
-func addInformersForScope(dynamicClient dynamic.Interface, gvr schema.GroupVersionResource, kind string, kubefs *KubeFS, scope apiextensionsv1.ResourceScope) {
-	if !kubefs.AllowsResource(gvr) {
-		return
+func removeCRDInformer(crd *apiextensionsv1.CustomResourceDefinition, kubefs *KubeFS) {
+	for _, version := range crd.Spec.Versions {
+		gvr := schema.GroupVersionResource{
+			Group:    crd.Spec.Group,
+			Version:  version.Name,
+			Resource: crd.Spec.Names.Plural,
+		}
+		kubefs.informers.stopGVR(gvr)
 	}
-	if kubefs.IsClusterScope() {
-		addInformer(dynamicClient, gvr, kind, kubefs, metav1.NamespaceAll)
-		return
+}
+
+func crdStorageGVRs(crd *apiextensionsv1.CustomResourceDefinition) []schema.GroupVersionResource {
+	result := make([]schema.GroupVersionResource, 0, 1)
+	for _, version := range crd.Spec.Versions {
+		if !version.Storage || !version.Served {
+			continue
+		}
+		result = append(result, schema.GroupVersionResource{
+			Group:    crd.Spec.Group,
+			Version:  version.Name,
+			Resource: crd.Spec.Names.Plural,
+		})
 	}
+	return result
+}
 
-	if scope != apiextensionsv1.NamespaceScoped {
-		return
+func informerTargetsForScope(gvr schema.GroupVersionResource, kind string, kubefs *KubeFS, scope apiextensionsv1.ResourceScope) []informerTarget {
+	namespaced := scope == apiextensionsv1.NamespaceScoped
+	if !kubefs.allowsType(gvr, kind, !namespaced) {
+		return nil
+	}
+	if kubefs.IsClusterScope() || !namespaced {
+		return []informerTarget{{key: informerKey{gvr: gvr, namespace: metav1.NamespaceAll}, kind: kind, namespaced: namespaced}}
 	}
 
 	if len(kubefs.AllowedNamespaces()) == 0 {
 		Warnf("Namespace scope enabled but no namespaces configured; skipping informer for %s", gvr.String())
-		return
+		return nil
 	}
 
+	var targets []informerTarget
 	for _, ns := range kubefs.AllowedNamespaces() {
-		addInformer(dynamicClient, gvr, kind, kubefs, ns)
-	}
-}
-
-func informerKeysForGVR(gvr schema.GroupVersionResource) []informerKey {
-	keys := make([]informerKey, 0, len(activeInformers))
-	for key := range activeInformers {
-		if key.gvr == gvr {
-			keys = append(keys, key)
-		}
+		targets = append(targets, informerTarget{key: informerKey{gvr: gvr, namespace: ns}, kind: kind, namespaced: true})
 	}
-	return keys
+	return targets
 }
 
 func informerSynced(informers ...cache.SharedInformer) []cache.InformerSynced {
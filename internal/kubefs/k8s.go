@@ -2,10 +2,10 @@ package kubefs
 
 import (
 	"context"
-	"time"
 
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
@@ -14,6 +14,10 @@ func (k *KubeFS) AddNamespace(ctx context.Context, name string, clusterwide bool
 	if inode != nil {
 		return
 	}
+	if kept := k.keptTerminating(name); kept != nil {
+		k.AddChild(name, kept, false)
+		return
+	}
 
 	ns := &Namespace{
 		Name:        name,
@@ -21,25 +25,23 @@ func (k *KubeFS) AddNamespace(ctx context.Context, name string, clusterwide bool
 		KubeFS:      k,
 	}
 	k.AddChild(name, k.NewPersistentInode(ctx, ns, fs.StableAttr{Mode: fuse.S_IFDIR}), false)
-}
-
-func (k *KubeFS) RemoveNamespace(ctx context.Context, name string) {
-	inode := k.GetChild(name)
-	if inode != nil {
-		return
+	if k.GetConfig().HideOwned {
+		ns.addAllView(ctx)
 	}
-	k.RmChild(name)
 }
 
 func (k *KubeFS) AddResource(ctx context.Context, name string, plural string, namespace string, gvk schema.GroupVersionKind) {
+	k.addResource(ctx, name, plural, namespace, gvk, false)
+}
+
+// addResource adds the file for an object to its namespace directory and to
+// the .all view, if any. Hidden objects are only added to the view.
+func (k *KubeFS) addResource(ctx context.Context, name string, plural string, namespace string, gvk schema.GroupVersionKind, hidden bool) {
 	gvr := gvk.GroupVersion().WithResource(plural)
-	if !k.AllowsResource(gvr) {
+	if !k.allowsType(gvr, gvk.Kind, namespace == "") {
 		return
 	}
 	if namespace == "" {
-		if !k.IsClusterScope() {
-			return
-		}
 		namespace = "clusterwide"
 	} else if !k.AllowsNamespace(namespace) {
 		return
@@ -53,7 +55,17 @@ func (k *KubeFS) AddResource(ctx context.Context, name string, plural string, na
 	}
 
 	ns := nsInode.Operations().(*Namespace)
+	if view := ns.allView(); view != nil {
+		k.addResourceFile(ctx, view, name, gvr, gvk)
+	}
+	if hidden {
+		nsInode.RmChild((&Resource{Name: name, GroupVersionKind: gvk}).Filename())
+		return
+	}
+	k.addResourceFile(ctx, ns, name, gvr, gvk)
+}
 
+func (k *KubeFS) addResourceFile(ctx context.Context, ns *Namespace, name string, gvr schema.GroupVersionResource, gvk schema.GroupVersionKind) {
 	res := &Resource{
 		Name:                 name,
 		Namespace:            ns,
@@ -62,38 +74,46 @@ func (k *KubeFS) AddResource(ctx context.Context, name string, plural string, na
 		KubeFS:               k,
 	}
 
-	if child := nsInode.GetChild(res.Filename()); child != nil {
+	if child := ns.GetChild(res.Filename()); child != nil {
 		go func() {
-			child.Operations().(*Resource).changes++
-			child.Operations().(*Resource).updatedAt = time.Now()
+			child.Operations().(*Resource).touch()
 
 			child.NotifyContent(0, 0)
 		}()
 		return
 	}
 
-	nsInode.AddChild(res.Filename(), k.NewPersistentInode(ctx, res, fs.StableAttr{Mode: fuse.S_IFREG}), false)
+	ns.AddChild(res.Filename(), k.NewPersistentInode(ctx, res, fs.StableAttr{Mode: fuse.S_IFREG}), false)
+}
+
+// syncObject adds the file for an object passing the object filters and
+// removes it otherwise, e.g. after its labels changed.
+func (k *KubeFS) syncObject(ctx context.Context, gvr schema.GroupVersionResource, gvk schema.GroupVersionKind, object metav1.Object) {
+	if !k.AllowsObject(gvr, gvk.Kind, object) {
+		k.DeleteResource(ctx, object.GetName(), gvr.Resource, object.GetNamespace(), gvk)
+		return
+	}
+	k.addResource(ctx, object.GetName(), gvr.Resource, object.GetNamespace(), gvk, k.hidesOwned(gvk.Kind, object))
+	k.markDeletion(gvk, object)
 }
 
 func (k *KubeFS) DeleteResource(ctx context.Context, name string, plural string, namespace string, gvk schema.GroupVersionKind) {
 	gvr := gvk.GroupVersion().WithResource(plural)
-	if !k.AllowsResource(gvr) {
+	if !k.allowsType(gvr, gvk.Kind, namespace == "") {
 		return
 	}
-	if namespace == "" {
-		if !k.IsClusterScope() {
-			return
-		}
-		namespace = "clusterwide"
-	} else if !k.AllowsNamespace(namespace) {
+	if namespace != "" && !k.AllowsNamespace(namespace) {
 		return
 	}
 
-	res := &Resource{
-		Name:                 name,
-		GroupVersionKind:     gvk,
-		GroupVersionResource: gvr,
-		KubeFS:               k,
+	k.removeResourceFile(name, namespace, gvk)
+}
+
+// removeResourceFile drops the file for an object regardless of the current
+// filters, so files can be cleaned up after a resource becomes denied.
+func (k *KubeFS) removeResourceFile(name string, namespace string, gvk schema.GroupVersionKind) {
+	if namespace == "" {
+		namespace = "clusterwide"
 	}
 
 	nsInode := k.GetChild(namespace)
@@ -101,6 +121,18 @@ func (k *KubeFS) DeleteResource(ctx context.Context, name string, plural string,
 		return
 	}
 
-	filename := res.Filename()
-	nsInode.RmChild(filename)
+	res := &Resource{
+		Name:             name,
+		GroupVersionKind: gvk,
+	}
+	nsInode.RmChild(res.Filename())
+	if ns, ok := nsInode.Operations().(*Namespace); ok {
+		ns.dropPending(res.Filename())
+	}
+	if view := nsInode.GetChild(allDir); view != nil {
+		view.RmChild(res.Filename())
+		if ns, ok := view.Operations().(*Namespace); ok {
+			ns.dropPending(res.Filename())
+		}
+	}
 }
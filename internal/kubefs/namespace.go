@@ -2,12 +2,18 @@ package kubefs
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
@@ -17,19 +23,126 @@ type Namespace struct {
 	Clusterwide bool
 	KubeFS      *KubeFS
 
+	phaseMu sync.Mutex
+	phase   string
+
+	// parent is set on the .all view and points to the namespace directory
+	// it belongs to.
+	parent *Namespace
+
+	// pending holds files that rm or mv dropped while their object still
+	// exists: objects held by finalizers, and files renamed to a backup name.
+	// They are listed again until the informer reports the object gone.
+	pendingMu sync.Mutex
+	pending   map[string]*fs.Inode
+
 	fs.Inode
 }
 
+// generatedObjects are created by Kubernetes in every namespace and do not
+// make a namespace count as non-empty.
+var generatedObjects = map[string]struct{}{
+	"default.serviceaccount.core.v1.yaml":     {},
+	"kube-root-ca.crt.configmap.core.v1.yaml": {},
+}
+
+// namespaceHoldsObjects reports whether a namespace still holds objects on
+// the API server, other than generated objects and events. Every namespaced
+// type is listed regardless of the filters and of lazy informers, as objects
+// the mount does not show would be deleted with the namespace too.
+func (k *KubeFS) namespaceHoldsObjects(ctx context.Context, namespace string) (bool, error) {
+	if k.DynamicClient == nil || k.DiscoveryClient == nil {
+		return false, errors.New("clients not configured")
+	}
+	resourceLists, err := k.preferredResources()
+	if err != nil {
+		return false, err
+	}
+	for _, resourceList := range resourceLists {
+		groupVersion, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, resource := range resourceList.APIResources {
+			if !resource.Namespaced || strings.Contains(resource.Name, "/") || resource.Kind == "Event" || !slices.Contains(resource.Verbs, "list") {
+				continue
+			}
+			gvr := groupVersion.WithResource(resource.Name)
+			// At most one generated object exists per type, so one more
+			// item is enough to tell.
+			list, err := k.DynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{Limit: 2})
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return false, fmt.Errorf("listing %s: %w", gvrPath(gvr), err)
+			}
+			for _, item := range list.Items {
+				filename := (&Resource{Name: item.GetName(), GroupVersionKind: groupVersion.WithKind(resource.Kind)}).Filename()
+				if _, generated := generatedObjects[filename]; !generated {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+var _ = (fs.NodeGetattrer)((*Namespace)(nil))
+
+func (n *Namespace) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = fuse.S_IFDIR | 0755
+	if n.IsTerminating() {
+		out.Mode = fuse.S_IFDIR | 0555
+	}
+	return 0
+}
+
 var _ = (fs.NodeUnlinker)((*Namespace)(nil))
 var _ = (fs.NodeCreater)((*Namespace)(nil))
+var _ = (fs.NodeLookuper)((*Namespace)(nil))
+var _ = (fs.NodeOpendirer)((*Namespace)(nil))
+
+func (n *Namespace) Opendir(ctx context.Context) syscall.Errno {
+	if n.KubeFS != nil {
+		n.KubeFS.informers.ensureForNamespace(n)
+	}
+	n.restorePending("")
+	return 0
+}
+
+func (n *Namespace) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	if n.KubeFS != nil {
+		n.KubeFS.informers.ensureForFile(n, name)
+	}
+	n.restorePending(name)
+	child := n.GetChild(name)
+	if child == nil {
+		return nil, syscall.ENOENT
+	}
+	if getter, ok := child.Operations().(fs.NodeGetattrer); ok {
+		var attr fuse.AttrOut
+		if errno := getter.Getattr(ctx, nil, &attr); errno == 0 {
+			out.Attr = attr.Attr
+		}
+	}
+	return child, 0
+}
 
 func (n *Namespace) Unlink(ctx context.Context, name string) syscall.Errno {
 	if n.KubeFS == nil {
 		return syscall.EIO
 	}
+	if n.scratchFile(name) != nil {
+		n.RmChild(name)
+		return 0
+	}
 	if !n.KubeFS.GetConfig().AllowDelete {
 		return syscall.EPERM
 	}
+	if n.IsTerminating() {
+		return syscall.EROFS
+	}
 	child := n.GetChild(name)
 	if child == nil {
 		return syscall.ENOENT
@@ -38,22 +151,30 @@ func (n *Namespace) Unlink(ctx context.Context, name string) syscall.Errno {
 	if !ok {
 		return syscall.EPERM
 	}
-
 	if errno := resource.deleteResource(ctx); errno != 0 {
 		return errno
 	}
 
-	n.RmChild(name)
-	Infof("Deleted %s", resource.logRef())
+	if !n.pendingDeletion(ctx, name, child, resource) {
+		Infof("Deleted %s", resource.logRef())
+	}
 	return 0
 }
 
 func (n *Namespace) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
 	Debugf("Create requested: %s/%s", n.Name, name)
+	if !isResourceFilename(name) {
+		return n.createScratch(ctx, name, out)
+	}
 	if n.KubeFS == nil || n.KubeFS.DynamicClient == nil || n.KubeFS.DiscoveryClient == nil {
 		Errorf("Create failed: discovery client not ready for %s/%s", n.Name, name)
 		return nil, nil, 0, syscall.EIO
 	}
+	resourceName, gvr, kind, err := n.KubeFS.resolveFilename(name)
+	if errors.Is(err, errUnknownType) {
+		Debugf("%s/%s names no known resource type, keeping it as a scratch file", n.Name, name)
+		return n.createScratch(ctx, name, out)
+	}
 	if !n.KubeFS.GetConfig().AllowCreate {
 		Warnf("Create blocked (allowCreate=false): %s/%s", n.Name, name)
 		return nil, nil, 0, syscall.EPERM
@@ -61,6 +182,10 @@ func (n *Namespace) Create(ctx context.Context, name string, flags uint32, mode
 	if n.Clusterwide && !n.KubeFS.IsClusterScope() {
 		return nil, nil, 0, syscall.EPERM
 	}
+	if n.IsTerminating() {
+		Warnf("Create blocked, namespace %s is terminating: %s", n.Name, name)
+		return nil, nil, 0, syscall.EROFS
+	}
 	if !n.Clusterwide && !n.KubeFS.AllowsNamespace(n.Name) {
 		return nil, nil, 0, syscall.EPERM
 	}
@@ -68,19 +193,11 @@ func (n *Namespace) Create(ctx context.Context, name string, flags uint32, mode
 		Warnf("Create failed: %s/%s already exists", n.Name, name)
 		return nil, nil, 0, syscall.EEXIST
 	}
-
-	resourceName, kindName, groupName, version, ok := parseResourceFilename(name)
-	if !ok {
-		Warnf("Create failed: invalid filename %s/%s", n.Name, name)
-		return nil, nil, 0, syscall.EINVAL
-	}
-
-	gvr, kind, err := n.KubeFS.ResolveResource(groupName, version, kindName)
 	if err != nil {
 		Warnf("Failed to resolve resource for %s: %v", name, err)
 		return nil, nil, 0, syscall.EINVAL
 	}
-	if !n.KubeFS.AllowsResource(gvr) {
+	if !n.KubeFS.allowsType(gvr, kind, n.Clusterwide) {
 		Warnf("Create blocked by filters: %s/%s", n.Name, name)
 		return nil, nil, 0, syscall.EPERM
 	}
@@ -92,16 +209,32 @@ func (n *Namespace) Create(ctx context.Context, name string, flags uint32, mode
 		GroupVersionResource: gvr,
 		KubeFS:               n.KubeFS,
 		updatedAt:            time.Now(),
-		dirty:                true,
+	}
+	_, res.generating = generateNamePrefix(resourceName)
+	// Short filenames are only a way to type less; the file is listed under
+	// the name it was created with and moved to its full name once the object
+	// is applied.
+	if name != res.Filename() {
+		if n.GetChild(res.Filename()) != nil {
+			Warnf("Create failed: %s/%s already exists", n.Name, res.Filename())
+			return nil, nil, 0, syscall.EEXIST
+		}
+		res.alias = name
 	}
 
-	res.data = []byte(buildResourceSkeleton(res))
+	res.draft = []byte(n.KubeFS.resourceSkeleton(res))
+	handle := &resourceHandle{
+		resource: res,
+		data:     append([]byte(nil), res.draft...),
+		writable: true,
+		dirty:    true,
+	}
 
 	inode := n.NewPersistentInode(ctx, res, fs.StableAttr{Mode: fuse.S_IFREG})
 	n.AddChild(name, inode, false)
 	out.Attr.Mode = fuse.S_IFREG | 0664
 	Infof("Created %s", res.logRef())
-	return inode, res, fuse.FOPEN_DIRECT_IO, 0
+	return inode, handle, fuse.FOPEN_DIRECT_IO, 0
 }
 
 func buildResourceSkeleton(res *Resource) string {
@@ -110,9 +243,14 @@ func buildResourceSkeleton(res *Resource) string {
 		apiVersion = res.GroupVersionKind.Group + "/" + res.GroupVersionKind.Version
 	}
 
+	nameField := "name: " + res.Name
+	if res.generating {
+		nameField = "generateName: " + defaultGenerateName(res)
+	}
+
 	if res.Namespace != nil && !res.Namespace.Clusterwide {
-		return fmt.Sprintf("apiVersion: %s\nkind: %s\nmetadata:\n  name: %s\n  namespace: %s\n", apiVersion, res.GroupVersionKind.Kind, res.Name, res.Namespace.Name)
+		return fmt.Sprintf("apiVersion: %s\nkind: %s\nmetadata:\n  %s\n  namespace: %s\n", apiVersion, res.GroupVersionKind.Kind, nameField, res.Namespace.Name)
 	}
 
-	return fmt.Sprintf("apiVersion: %s\nkind: %s\nmetadata:\n  name: %s\n", apiVersion, res.GroupVersionKind.Kind, res.Name)
+	return fmt.Sprintf("apiVersion: %s\nkind: %s\nmetadata:\n  %s\n", apiVersion, res.GroupVersionKind.Kind, nameField)
 }
@@ -0,0 +1,185 @@
+package kubefs
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PhaseMissing marks a configured namespace that does not exist on the
+// cluster, which can only happen in namespace scope.
+const PhaseMissing = "Missing"
+
+// phaseXattr exposes the namespace phase on its directory.
+const phaseXattr = "user.kubefs.phase"
+
+const namespaceCheckInterval = 30 * time.Second
+
+// SetPhase records the namespace phase. Any phase other than Active shows
+// the directory read-only and rejects writes until the namespace is back.
+func (n *Namespace) SetPhase(phase string) {
+	n.phaseMu.Lock()
+	n.phase = phase
+	n.phaseMu.Unlock()
+}
+
+func (n *Namespace) Phase() string {
+	if n.parent != nil {
+		return n.parent.Phase()
+	}
+	n.phaseMu.Lock()
+	defer n.phaseMu.Unlock()
+	if n.phase == "" {
+		return string(corev1.NamespaceActive)
+	}
+	return n.phase
+}
+
+func (n *Namespace) IsTerminating() bool {
+	return n.Phase() != string(corev1.NamespaceActive)
+}
+
+var _ = (fs.NodeGetxattrer)((*Namespace)(nil))
+var _ = (fs.NodeListxattrer)((*Namespace)(nil))
+
+func (n *Namespace) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	if attr != phaseXattr {
+		return 0, syscall.ENODATA
+	}
+	return copyXattr(dest, []byte(n.Phase()))
+}
+
+func (n *Namespace) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	return copyXattr(dest, []byte(phaseXattr+"\x00"))
+}
+
+func copyXattr(dest []byte, value []byte) (uint32, syscall.Errno) {
+	if len(dest) < len(value) {
+		return uint32(len(value)), syscall.ERANGE
+	}
+	return uint32(copy(dest, value)), 0
+}
+
+// SetNamespacePhase updates the phase of a namespace directory. A namespace
+// that is still terminating is re-added if rmdir already dropped it.
+func (k *KubeFS) SetNamespacePhase(ctx context.Context, name string, phase string) {
+	if phase == string(corev1.NamespaceTerminating) {
+		k.AddNamespace(ctx, name, false)
+	}
+	inode := k.GetChild(name)
+	if inode == nil {
+		return
+	}
+	ns, ok := inode.Operations().(*Namespace)
+	if !ok {
+		return
+	}
+	if ns.Phase() != phase {
+		Infof("Namespace %s is %s", name, phase)
+	}
+	ns.SetPhase(phase)
+}
+
+// RemoveNamespace drops a namespace directory together with every resource
+// inode below it.
+func (k *KubeFS) RemoveNamespace(ctx context.Context, name string) {
+	kept := k.dropTerminating(name)
+	inode := k.GetChild(name)
+	if inode == nil {
+		inode = kept
+	}
+	if inode == nil {
+		return
+	}
+	if _, ok := inode.Operations().(*Namespace); !ok {
+		return
+	}
+
+	forgetChildren(inode)
+	k.RmChild(name)
+	inode.ForgetPersistent()
+	Infof("Removed namespace directory %s", name)
+}
+
+// A successful rmdir makes the bridge drop the directory, while the
+// namespace is only terminating. Its inode is kept here and put back on the
+// next lookup or listing of the root, and by AddNamespace, until
+// RemoveNamespace reports the namespace gone.
+func (k *KubeFS) keepTerminating(name string, inode *fs.Inode) {
+	k.terminatingMu.Lock()
+	defer k.terminatingMu.Unlock()
+	if k.terminating == nil {
+		k.terminating = make(map[string]*fs.Inode)
+	}
+	k.terminating[name] = inode
+}
+
+func (k *KubeFS) dropTerminating(name string) *fs.Inode {
+	k.terminatingMu.Lock()
+	defer k.terminatingMu.Unlock()
+	inode := k.terminating[name]
+	delete(k.terminating, name)
+	return inode
+}
+
+func (k *KubeFS) keptTerminating(name string) *fs.Inode {
+	k.terminatingMu.Lock()
+	defer k.terminatingMu.Unlock()
+	return k.terminating[name]
+}
+
+// restoreTerminating lists the kept namespaces again.
+func (k *KubeFS) restoreTerminating() {
+	k.terminatingMu.Lock()
+	defer k.terminatingMu.Unlock()
+	for name, inode := range k.terminating {
+		if k.GetChild(name) == nil {
+			k.AddChild(name, inode, false)
+		}
+	}
+}
+
+// runNamespaceChecker polls the configured namespaces in namespace scope,
+// where no namespace informer runs, so deleted or terminating namespaces are
+// reported instead of silently showing up as empty directories.
+func (k *KubeFS) runNamespaceChecker() {
+	ticker := time.NewTicker(namespaceCheckInterval)
+	defer ticker.Stop()
+	for {
+		k.checkNamespaces(k.informers.ctx)
+		select {
+		case <-k.informers.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (k *KubeFS) checkNamespaces(ctx context.Context) {
+	if k.IsClusterScope() || k.UsesNamespaceInformer() || k.kubeClient == nil {
+		return
+	}
+	for _, name := range k.AllowedNamespaces() {
+		namespace, err := k.kubeClient.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case err == nil:
+			k.SetNamespacePhase(ctx, name, string(namespace.Status.Phase))
+		case apierrors.IsNotFound(err):
+			if inode := k.GetChild(name); inode != nil {
+				if ns, ok := inode.Operations().(*Namespace); ok && ns.Phase() != PhaseMissing {
+					Warnf("Namespace %s is configured but does not exist on the cluster", name)
+				}
+			}
+			k.SetNamespacePhase(ctx, name, PhaseMissing)
+		case apierrors.IsForbidden(err):
+			Debugf("Cannot check namespace %s: %v", name, err)
+		default:
+			Warnf("Failed to check namespace %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package kubefs
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRemoveNamespace_DropsDirectoryAndResources(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{Scope: ScopeCluster})
+	kfs.AddNamespace(context.Background(), "team-a", false)
+	kfs.AddResource(context.Background(), "web", "deployments", "team-a", schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+	nsInode := kfs.GetChild("team-a")
+
+	kfs.RemoveNamespace(context.Background(), "team-a")
+
+	if kfs.GetChild("team-a") != nil {
+		t.Fatalf("expected namespace directory to be removed")
+	}
+	if len(nsInode.Children()) != 0 {
+		t.Fatalf("expected resource inodes to be removed, got %v", nsInode.Children())
+	}
+}
+
+func TestNamespacePhase_Xattr(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{Scope: ScopeCluster})
+	kfs.AddNamespace(context.Background(), "team-a", false)
+	ns := kfs.GetChild("team-a").Operations().(*Namespace)
+
+	dest := make([]byte, 32)
+	size, errno := ns.Getxattr(context.Background(), phaseXattr, dest)
+	if errno != 0 || string(dest[:size]) != "Active" {
+		t.Fatalf("expected Active phase, got %q (%v)", dest[:size], errno)
+	}
+
+	kfs.SetNamespacePhase(context.Background(), "team-a", string(corev1.NamespaceTerminating))
+	size, errno = ns.Getxattr(context.Background(), phaseXattr, dest)
+	if errno != 0 || string(dest[:size]) != "Terminating" {
+		t.Fatalf("expected Terminating phase, got %q (%v)", dest[:size], errno)
+	}
+	if _, errno := ns.Getxattr(context.Background(), phaseXattr, make([]byte, 2)); errno != syscall.ERANGE {
+		t.Fatalf("expected ERANGE for a short buffer, got %v", errno)
+	}
+	if !ns.IsTerminating() {
+		t.Fatalf("expected namespace to be read-only while terminating")
+	}
+}
+
+func TestCheckNamespaces_ReportsMissing(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{Scope: ScopeNamespace, Namespaces: []string{"dev", "qa"}})
+	kfs.kubeClient = fake.NewClientset(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev"},
+		Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+	})
+	kfs.ReconcileNamespaces(context.Background())
+
+	kfs.checkNamespaces(context.Background())
+
+	dev := kfs.GetChild("dev").Operations().(*Namespace)
+	qa := kfs.GetChild("qa").Operations().(*Namespace)
+	if dev.Phase() != "Active" {
+		t.Fatalf("expected dev to be Active, got %s", dev.Phase())
+	}
+	if qa.Phase() != PhaseMissing {
+		t.Fatalf("expected qa to be %s, got %s", PhaseMissing, qa.Phase())
+	}
+}
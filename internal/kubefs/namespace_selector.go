@@ -0,0 +1,188 @@
+package kubefs
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// namespaceMatcher decides which namespaces are mounted in namespace scope.
+// Entries of Config.Namespaces are exact names, glob patterns such as
+// "team-a-*", or regular expressions wrapped in slashes such as "/^pr-\d+$/".
+// When a namespaceSelector is set, a namespace must also match its labels.
+type namespaceMatcher struct {
+	names    map[string]struct{}
+	globs    []string
+	regexps  []*regexp.Regexp
+	selector labels.Selector
+}
+
+func newNamespaceMatcher(cfg Config) (*namespaceMatcher, error) {
+	matcher, err := newNamespacePatterns(cfg.Namespaces)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(cfg.NamespaceSelector) != "" {
+		selector, err := labels.Parse(cfg.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespaceSelector %q: %w", cfg.NamespaceSelector, err)
+		}
+		matcher.selector = selector
+	}
+	return matcher, nil
+}
+
+// newNamespacePatterns compiles namespace names, globs and /regex/ entries,
+// as accepted by namespaces: in the config and in filter rules.
+func newNamespacePatterns(entries []string) (*namespaceMatcher, error) {
+	matcher := &namespaceMatcher{names: make(map[string]struct{})}
+	for _, entry := range entries {
+		switch {
+		case isRegexpPattern(entry):
+			expr, err := regexp.Compile(entry[1 : len(entry)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid namespace pattern %q: %w", entry, err)
+			}
+			matcher.regexps = append(matcher.regexps, expr)
+		case isGlobPattern(entry):
+			if _, err := path.Match(entry, ""); err != nil {
+				return nil, fmt.Errorf("invalid namespace pattern %q: %w", entry, err)
+			}
+			matcher.globs = append(matcher.globs, entry)
+		default:
+			matcher.names[entry] = struct{}{}
+		}
+	}
+	return matcher, nil
+}
+
+func isRegexpPattern(entry string) bool {
+	return len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/")
+}
+
+func isGlobPattern(entry string) bool {
+	return strings.ContainsAny(entry, "*?[")
+}
+
+// dynamic reports whether the matched set can only be known by watching
+// namespaces, as opposed to a fixed list of names.
+func (m *namespaceMatcher) dynamic() bool {
+	return len(m.globs) > 0 || len(m.regexps) > 0 || m.selector != nil
+}
+
+func (m *namespaceMatcher) matches(name string, namespaceLabels map[string]string) bool {
+	if m.selector != nil && !m.selector.Matches(labels.Set(namespaceLabels)) {
+		return false
+	}
+	if len(m.names) == 0 && len(m.globs) == 0 && len(m.regexps) == 0 {
+		return m.selector != nil
+	}
+	return m.matchesName(name)
+}
+
+func (m *namespaceMatcher) matchesName(name string) bool {
+	if _, ok := m.names[name]; ok {
+		return true
+	}
+	for _, glob := range m.globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+	for _, expr := range m.regexps {
+		if expr.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *KubeFS) namespaceMatcher() *namespaceMatcher {
+	k.configMu.RLock()
+	defer k.configMu.RUnlock()
+	return k.matcher
+}
+
+// matchedNamespaceList returns the namespaces currently selected by a dynamic
+// matcher, sorted by name.
+func (k *KubeFS) matchedNamespaceList() []string {
+	k.nsMu.RLock()
+	defer k.nsMu.RUnlock()
+	result := make([]string, 0, len(k.matched))
+	for name := range k.matched {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// evaluateNamespace is called for every namespace event in namespace scope. It
+// adds the namespace directory and its informers when the namespace starts
+// matching, and removes them when it stops matching or is deleted.
+func (k *KubeFS) evaluateNamespace(ctx context.Context, namespace *corev1.Namespace, deleted bool) {
+	matches := !deleted && k.namespaceMatcher().matches(namespace.Name, namespace.Labels)
+
+	k.nsMu.Lock()
+	_, wasMatched := k.matched[namespace.Name]
+	if matches {
+		k.matched[namespace.Name] = struct{}{}
+	} else {
+		delete(k.matched, namespace.Name)
+	}
+	k.nsMu.Unlock()
+
+	switch {
+	case matches && !wasMatched:
+		Infof("Namespace %s matches the namespace selection; mounting it", namespace.Name)
+		k.AddNamespace(ctx, namespace.Name, false)
+		k.SetNamespacePhase(ctx, namespace.Name, string(namespace.Status.Phase))
+		k.requestDiscovery()
+	case matches:
+		k.SetNamespacePhase(ctx, namespace.Name, string(namespace.Status.Phase))
+	case wasMatched:
+		Infof("Namespace %s no longer matches the namespace selection; unmounting it", namespace.Name)
+		k.informers.stopDenied()
+		k.RemoveNamespace(ctx, namespace.Name)
+	}
+}
+
+// rematchNamespaces re-evaluates every watched namespace against the current
+// matcher, after the patterns changed or the namespace informer restarted.
+// Namespaces that are no longer watched are unmounted.
+func (k *KubeFS) rematchNamespaces(ctx context.Context) {
+	if !k.UsesNamespaceInformer() {
+		k.nsMu.Lock()
+		k.matched = make(map[string]struct{})
+		k.nsMu.Unlock()
+		return
+	}
+
+	k.scopeMu.Lock()
+	scope := k.scope
+	k.scopeMu.Unlock()
+	if scope == nil || scope.namespaceInformer == nil {
+		return
+	}
+
+	seen := make(map[string]struct{})
+	for _, obj := range scope.namespaceInformer.GetStore().List() {
+		namespace, ok := obj.(*corev1.Namespace)
+		if !ok {
+			continue
+		}
+		seen[namespace.Name] = struct{}{}
+		k.evaluateNamespace(ctx, namespace, false)
+	}
+	for _, name := range k.matchedNamespaceList() {
+		if _, ok := seen[name]; !ok {
+			k.evaluateNamespace(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}, true)
+		}
+	}
+}
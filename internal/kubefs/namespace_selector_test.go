@@ -0,0 +1,118 @@
+package kubefs
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNamespaceMatcher_Patterns(t *testing.T) {
+	matcher, err := newNamespaceMatcher(Config{Namespaces: []string{"dev", "team-a-*", "/^pr-[0-9]+$/"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !matcher.dynamic() {
+		t.Fatalf("expected patterns to make the matcher dynamic")
+	}
+
+	cases := map[string]bool{
+		"dev":        true,
+		"team-a-web": true,
+		"team-b-web": false,
+		"pr-42":      true,
+		"pr-main":    false,
+	}
+	for name, expected := range cases {
+		if got := matcher.matches(name, nil); got != expected {
+			t.Fatalf("matches(%q) = %t, expected %t", name, got, expected)
+		}
+	}
+}
+
+func TestNamespaceMatcher_Selector(t *testing.T) {
+	matcher, err := newNamespaceMatcher(Config{NamespaceSelector: "team=a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !matcher.matches("anything", map[string]string{"team": "a"}) {
+		t.Fatalf("expected selector alone to match labelled namespaces")
+	}
+	if matcher.matches("anything", map[string]string{"team": "b"}) {
+		t.Fatalf("expected selector to reject other labels")
+	}
+
+	matcher, err = newNamespaceMatcher(Config{Namespaces: []string{"dev-*"}, NamespaceSelector: "team=a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if matcher.matches("prod", map[string]string{"team": "a"}) {
+		t.Fatalf("expected selector and patterns to both apply")
+	}
+	if !matcher.matches("dev-1", map[string]string{"team": "a"}) {
+		t.Fatalf("expected namespace matching both to be selected")
+	}
+}
+
+func TestNamespaceMatcher_ExactNamesAreStatic(t *testing.T) {
+	matcher, err := newNamespaceMatcher(Config{Namespaces: []string{"dev", "qa"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if matcher.dynamic() {
+		t.Fatalf("expected exact names not to need a namespace informer")
+	}
+}
+
+func TestParseConfig_RejectsInvalidNamespacePatterns(t *testing.T) {
+	for _, data := range []string{
+		"namespaces: ['/pr-(/']\n",
+		"namespaces: ['team-[']\n",
+		"namespaceSelector: 'team in (a'\n",
+	} {
+		if _, err := ParseConfig([]byte(data)); err == nil {
+			t.Fatalf("expected error for %q", data)
+		}
+	}
+}
+
+func TestParseConfig_KeepsRegexpCase(t *testing.T) {
+	cfg, err := ParseConfig([]byte("namespaces: ['/^PR-\\d+$/', Dev]\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Namespaces) != 2 || cfg.Namespaces[0] != "/^PR-\\d+$/" || cfg.Namespaces[1] != "dev" {
+		t.Fatalf("unexpected namespaces: %v", cfg.Namespaces)
+	}
+}
+
+func TestEvaluateNamespace_MountsAndUnmounts(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{Scope: ScopeNamespace, Namespaces: []string{"team-a-*"}})
+	ctx := context.Background()
+	web := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a-web"},
+		Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+	}
+	other := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b-web"}}
+
+	kfs.evaluateNamespace(ctx, web, false)
+	kfs.evaluateNamespace(ctx, other, false)
+	if kfs.GetChild("team-a-web") == nil {
+		t.Fatalf("expected matching namespace to be mounted")
+	}
+	if kfs.GetChild("team-b-web") != nil {
+		t.Fatalf("expected other namespace not to be mounted")
+	}
+	if !kfs.AllowsNamespace("team-a-web") || kfs.AllowsNamespace("team-b-web") {
+		t.Fatalf("unexpected allowed namespaces: %v", kfs.AllowedNamespaces())
+	}
+
+	kfs.evaluateNamespace(ctx, web, true)
+	if kfs.GetChild("team-a-web") != nil {
+		t.Fatalf("expected deleted namespace to be unmounted")
+	}
+	if len(kfs.AllowedNamespaces()) != 0 {
+		t.Fatalf("expected no allowed namespaces, got %v", kfs.AllowedNamespaces())
+	}
+}
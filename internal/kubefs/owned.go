@@ -0,0 +1,85 @@
+package kubefs
+
+import (
+	"context"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// allDir is the directory inside each namespace that lists every object,
+// including the ones hidden by hideOwned.
+const allDir = ".all"
+
+// hidesOwned reports whether an object is left out of its namespace listing
+// because a controller owns it.
+func (k *KubeFS) hidesOwned(kind string, object metav1.Object) bool {
+	cfg := k.GetConfig()
+	if !cfg.HideOwned || metav1.GetControllerOf(object) == nil {
+		return false
+	}
+	return !matchValue(cfg.HideOwnedExcept, kind)
+}
+
+func (n *Namespace) allView() *Namespace {
+	if n.parent != nil {
+		return nil
+	}
+	child := n.GetChild(allDir)
+	if child == nil {
+		return nil
+	}
+	view, _ := child.Operations().(*Namespace)
+	return view
+}
+
+func (n *Namespace) addAllView(ctx context.Context) {
+	if n.parent != nil || n.GetChild(allDir) != nil {
+		return
+	}
+	view := &Namespace{
+		Name:        n.Name,
+		Clusterwide: n.Clusterwide,
+		KubeFS:      n.KubeFS,
+		parent:      n,
+	}
+	n.AddChild(allDir, n.NewPersistentInode(ctx, view, fs.StableAttr{Mode: fuse.S_IFDIR}), false)
+}
+
+func (n *Namespace) removeAllView() {
+	child := n.GetChild(allDir)
+	if child == nil {
+		return
+	}
+	forgetChildren(child)
+	n.RmChild(allDir)
+	child.ForgetPersistent()
+}
+
+// syncAllViews adds or removes the .all view of every namespace directory
+// after hideOwned was toggled.
+func (k *KubeFS) syncAllViews(ctx context.Context) {
+	hideOwned := k.GetConfig().HideOwned
+	for _, child := range k.Children() {
+		ns, ok := child.Operations().(*Namespace)
+		if !ok {
+			continue
+		}
+		if hideOwned {
+			ns.addAllView(ctx)
+		} else {
+			ns.removeAllView()
+		}
+	}
+}
+
+// forgetChildren removes every child of inode, recursively, so their
+// persistent inodes can be released.
+func forgetChildren(inode *fs.Inode) {
+	for name, child := range inode.Children() {
+		forgetChildren(child)
+		inode.RmChild(name)
+		child.ForgetPersistent()
+	}
+}
@@ -0,0 +1,78 @@
+package kubefs
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func ownedObject(name string, namespace string) *metav1.ObjectMeta {
+	controller := true
+	return &metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: "apps/v1",
+			Kind:       "ReplicaSet",
+			Name:       "web-5d8f",
+			Controller: &controller,
+		}},
+	}
+}
+
+func TestHideOwned_ListsOwnedObjectsOnlyUnderAll(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{Scope: ScopeCluster, HideOwned: true, HideOwnedExcept: []string{"job"}})
+	ctx := context.Background()
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	jobs := schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}
+	kfs.AddNamespace(ctx, "dev", false)
+
+	kfs.syncObject(ctx, pods, schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, ownedObject("web-5d8f-x2x", "dev"))
+	kfs.syncObject(ctx, pods, schema.GroupVersionKind{Version: "v1", Kind: "Pod"}, &metav1.ObjectMeta{Name: "debug", Namespace: "dev"})
+	kfs.syncObject(ctx, jobs, schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}, ownedObject("backup-1", "dev"))
+
+	dev := kfs.GetChild("dev")
+	all := dev.GetChild(allDir)
+	if all == nil {
+		t.Fatalf("expected .all directory when hideOwned is enabled")
+	}
+	if dev.GetChild("web-5d8f-x2x.pod.core.v1.yaml") != nil {
+		t.Fatalf("expected owned pod to be hidden from the namespace listing")
+	}
+	for _, name := range []string{"web-5d8f-x2x.pod.core.v1.yaml", "debug.pod.core.v1.yaml", "backup-1.job.batch.v1.yaml"} {
+		if all.GetChild(name) == nil {
+			t.Fatalf("expected %s under .all", name)
+		}
+	}
+	if dev.GetChild("debug.pod.core.v1.yaml") == nil || dev.GetChild("backup-1.job.batch.v1.yaml") == nil {
+		t.Fatalf("expected unowned objects and excepted kinds to stay listed")
+	}
+
+	kfs.removeResourceFile("debug", "dev", schema.GroupVersionKind{Version: "v1", Kind: "Pod"})
+	if dev.GetChild("debug.pod.core.v1.yaml") != nil || all.GetChild("debug.pod.core.v1.yaml") != nil {
+		t.Fatalf("expected removed object to disappear from both listings")
+	}
+}
+
+func TestSyncAllViews_FollowsConfig(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{Scope: ScopeCluster})
+	ctx := context.Background()
+	kfs.AddNamespace(ctx, "dev", false)
+	if kfs.GetChild("dev").GetChild(allDir) != nil {
+		t.Fatalf("expected no .all directory when hideOwned is disabled")
+	}
+
+	kfs.SetConfig(Config{Scope: ScopeCluster, HideOwned: true})
+	kfs.syncAllViews(ctx)
+	if kfs.GetChild("dev").GetChild(allDir) == nil {
+		t.Fatalf("expected .all directory after enabling hideOwned")
+	}
+
+	kfs.SetConfig(Config{Scope: ScopeCluster})
+	kfs.syncAllViews(ctx)
+	if kfs.GetChild("dev").GetChild(allDir) != nil {
+		t.Fatalf("expected .all directory to be removed after disabling hideOwned")
+	}
+}
@@ -0,0 +1,71 @@
+package kubefs
+
+import (
+	"context"
+)
+
+// ApplyConfig swaps in a reloaded configuration and reconciles the running
+// tree with it: informers and files for newly denied resources or namespaces
+// are removed, newly allowed ones are started, and namespace directories are
+// added or removed to match the scope.
+func (k *KubeFS) ApplyConfig(config Config) {
+	k.reloadMu.Lock()
+	defer k.reloadMu.Unlock()
+
+	oldConfig := k.GetConfig()
+	oldSelection := k.UsesNamespaceInformer()
+	k.SetConfig(config)
+
+	clientsReady := k.DynamicClient != nil && k.DiscoveryClient != nil
+	if clientsReady {
+		switch {
+		case oldConfig.Scope != config.Scope:
+			Infof("Scope changed from %s to %s; restarting namespace and CRD informers", oldConfig.Scope, config.Scope)
+			startScopeInformers(k)
+		case oldSelection != k.UsesNamespaceInformer() || oldConfig.NamespaceSelector != config.NamespaceSelector:
+			Infof("Namespace selection changed; restarting namespace informer")
+			startScopeInformers(k)
+		}
+	}
+	k.rematchNamespaces(context.Background())
+
+	k.informers.stopDenied()
+	k.ReconcileNamespaces(context.Background())
+	k.syncAllViews(context.Background())
+	k.informers.refilter()
+
+	if !clientsReady {
+		return
+	}
+	discoverResources(k.DiscoveryClient, k.DynamicClient, k)
+	replayCRDs(k)
+}
+
+// ReconcileNamespaces adds and removes namespace directories so they match
+// the configured scope. In cluster scope the namespace informer owns the
+// directories, so only the clusterwide directory is managed here. In
+// namespace scope the clusterwide directory is only kept when
+// clusterResources are configured.
+func (k *KubeFS) ReconcileNamespaces(ctx context.Context) {
+	if k.IsClusterScope() {
+		k.AddNamespace(ctx, "clusterwide", true)
+		return
+	}
+
+	keepClusterwide := len(k.GetConfig().ClusterResources) > 0
+	for name, child := range k.Children() {
+		ns, ok := child.Operations().(*Namespace)
+		if !ok {
+			continue
+		}
+		if ns.Clusterwide && !keepClusterwide || !ns.Clusterwide && !k.AllowsNamespace(name) {
+			k.RemoveNamespace(ctx, name)
+		}
+	}
+	if keepClusterwide {
+		k.AddNamespace(ctx, "clusterwide", true)
+	}
+	for _, ns := range k.AllowedNamespaces() {
+		k.AddNamespace(ctx, ns, false)
+	}
+}
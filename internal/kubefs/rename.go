@@ -0,0 +1,130 @@
+package kubefs
+
+import (
+	"context"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = (fs.NodeRenamer)((*Namespace)(nil))
+
+// Rename implements mv for resource files. Renaming within a namespace
+// creates the object under the new name and deletes the old one; moving into
+// another namespace directory recreates it there. If deleting the original
+// fails, the new copy is removed again so exactly one copy remains.
+func (n *Namespace) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	Debugf("Rename requested: %s/%s -> %s", n.Name, name, newName)
+	if n.KubeFS == nil || n.KubeFS.DynamicClient == nil {
+		return syscall.EIO
+	}
+	if scratch := n.scratchFile(name); scratch != nil {
+		return n.renameScratch(ctx, scratch, newParent, newName, flags)
+	}
+	if !isResourceFilename(newName) {
+		return n.renameToScratch(ctx, name, newParent, newName, flags)
+	}
+	cfg := n.KubeFS.GetConfig()
+	if !cfg.AllowCreate || !cfg.AllowDelete {
+		Warnf("Rename blocked (allowCreate=%t, allowDelete=%t): %s/%s", cfg.AllowCreate, cfg.AllowDelete, n.Name, name)
+		return syscall.EPERM
+	}
+	if flags&fs.RENAME_EXCHANGE != 0 {
+		return syscall.EINVAL
+	}
+
+	target, ok := newParent.(*Namespace)
+	if !ok {
+		return syscall.EPERM
+	}
+	child := n.GetChild(name)
+	if child == nil {
+		return syscall.ENOENT
+	}
+	res, ok := child.Operations().(*Resource)
+	if !ok {
+		return syscall.EPERM
+	}
+	if n.IsTerminating() || target.IsTerminating() {
+		return syscall.EROFS
+	}
+	if target.Clusterwide != n.Clusterwide || (!target.Clusterwide && !n.KubeFS.AllowsNamespace(target.Name)) {
+		return syscall.EPERM
+	}
+	if target.GetChild(newName) != nil {
+		Warnf("Rename failed: %s/%s already exists", target.Name, newName)
+		return syscall.EEXIST
+	}
+
+	newResourceName, kindName, groupName, version, ok := parseResourceFilename(newName)
+	if !ok {
+		Warnf("Rename failed: invalid filename %s/%s", target.Name, newName)
+		return syscall.EINVAL
+	}
+	gvk := res.GroupVersionKind
+	if kindName != strings.ToLower(gvk.Kind) || groupName != gvk.Group || version != gvk.Version {
+		Warnf("Rename failed: %s cannot change kind, group or version", newName)
+		return syscall.EINVAL
+	}
+
+	live, err := res.getResource(ctx)
+	if err != nil {
+		Errorf("Error reading %s before rename: %v", res.logRef(), err)
+		return apiErrno(err)
+	}
+	obj := live.DeepCopy()
+	stripServerMetadata(obj)
+	obj.SetName(newResourceName)
+	if target.Clusterwide {
+		obj.SetNamespace("")
+	} else {
+		obj.SetNamespace(target.Name)
+	}
+	if target != n {
+		// Owners are namespaced and cannot follow the object elsewhere.
+		obj.SetOwnerReferences(nil)
+	}
+
+	if !n.KubeFS.allowsType(res.GroupVersionResource, gvk.Kind, target.Clusterwide) || !n.KubeFS.AllowsObject(res.GroupVersionResource, gvk.Kind, obj) {
+		Warnf("Rename blocked by filters: %s/%s", target.Name, newName)
+		return syscall.EPERM
+	}
+
+	client := n.KubeFS.resourceInterface(res.GroupVersionResource, target)
+	created, err := client.Create(ctx, obj, v1.CreateOptions{})
+	if err != nil {
+		Errorf("Error creating %s/%s during rename: %v", target.Name, newResourceName, err)
+		return apiErrno(err)
+	}
+	n.KubeFS.auditMutation(ctx, "create", res.GroupVersionResource, obj.GetNamespace(), newResourceName, nil, created)
+
+	// The original is deleted, not evicted, so the rename does not depend on
+	// disruption budgets once the copy exists.
+	if errno := res.deleteObject(ctx, false); errno != 0 {
+		Errorf("Rolling back rename of %s: removing %s/%s", res.logRef(), target.Name, newResourceName)
+		if err := client.Delete(ctx, newResourceName, v1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			Errorf("Rollback failed, both %s and %s/%s exist: %v", res.logRef(), target.Name, newResourceName, err)
+		} else if err == nil {
+			n.KubeFS.auditMutation(ctx, "delete", res.GroupVersionResource, obj.GetNamespace(), newResourceName, created, nil)
+		}
+		return errno
+	}
+
+	oldRef := res.logRef()
+	res.rename(newResourceName, target)
+	Infof("Renamed %s to %s", oldRef, res.logRef())
+	return 0
+}
+
+// stripServerMetadata removes fields populated by the API server so the
+// object can be created again as a new object.
+func stripServerMetadata(obj *unstructured.Unstructured) {
+	for _, field := range []string{"uid", "resourceVersion", "creationTimestamp", "generation", "managedFields", "selfLink", "deletionTimestamp", "deletionGracePeriodSeconds"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(obj.Object, "status")
+}
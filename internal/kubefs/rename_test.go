@@ -0,0 +1,139 @@
+package kubefs
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var configMapsGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+func newConfigMap(namespace string, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetUID("1234")
+	obj.SetResourceVersion("42")
+	_ = unstructured.SetNestedField(obj.Object, "value", "data", "key")
+	return obj
+}
+
+func newRenameFixture(t *testing.T) (*KubeFS, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	kfs := newTestKubeFS(t, Config{Scope: ScopeCluster, AllowCreate: true, AllowDelete: true})
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{configMapsGVR: "ConfigMapList"},
+		newConfigMap("dev", "settings"))
+	kfs.DynamicClient = client
+	kfs.AddNamespace(context.Background(), "dev", false)
+	kfs.AddNamespace(context.Background(), "qa", false)
+	kfs.AddResource(context.Background(), "settings", "configmaps", "dev", schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"})
+	return kfs, client
+}
+
+func namespaceNode(kfs *KubeFS, name string) *Namespace {
+	return kfs.GetChild(name).Operations().(*Namespace)
+}
+
+func TestRename_MovesToOtherNamespace(t *testing.T) {
+	kfs, client := newRenameFixture(t)
+	dev := namespaceNode(kfs, "dev")
+	qa := namespaceNode(kfs, "qa")
+
+	errno := dev.Rename(context.Background(), "settings.configmap.core.v1.yaml", qa, "copied.configmap.core.v1.yaml", 0)
+	if errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+
+	moved, err := client.Resource(configMapsGVR).Namespace("qa").Get(context.Background(), "copied", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected object in target namespace: %v", err)
+	}
+	if moved.GetUID() != "" || moved.GetResourceVersion() == "42" {
+		t.Fatalf("expected server metadata to be stripped, got uid=%q rv=%q", moved.GetUID(), moved.GetResourceVersion())
+	}
+	if _, err := client.Resource(configMapsGVR).Namespace("dev").Get(context.Background(), "settings", metav1.GetOptions{}); err == nil {
+		t.Fatalf("expected original object to be deleted")
+	}
+}
+
+func TestRename_RollsBackWhenDeleteFails(t *testing.T) {
+	kfs, client := newRenameFixture(t)
+	client.PrependReactor("delete", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.(clienttesting.DeleteAction).GetName() == "settings" {
+			return true, nil, errors.New("boom")
+		}
+		return false, nil, nil
+	})
+	dev := namespaceNode(kfs, "dev")
+
+	errno := dev.Rename(context.Background(), "settings.configmap.core.v1.yaml", dev, "renamed.configmap.core.v1.yaml", 0)
+	if errno != syscall.EIO {
+		t.Fatalf("expected EIO, got %v", errno)
+	}
+	if _, err := client.Resource(configMapsGVR).Namespace("dev").Get(context.Background(), "settings", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected original object to survive: %v", err)
+	}
+	if _, err := client.Resource(configMapsGVR).Namespace("dev").Get(context.Background(), "renamed", metav1.GetOptions{}); err == nil {
+		t.Fatalf("expected new copy to be rolled back")
+	}
+}
+
+func TestRename_RejectsKindChange(t *testing.T) {
+	kfs, _ := newRenameFixture(t)
+	dev := namespaceNode(kfs, "dev")
+
+	errno := dev.Rename(context.Background(), "settings.configmap.core.v1.yaml", dev, "settings.secret.core.v1.yaml", 0)
+	if errno != syscall.EINVAL {
+		t.Fatalf("expected EINVAL, got %v", errno)
+	}
+}
+
+func TestRename_ChecksFiltersOnTarget(t *testing.T) {
+	kfs, client := newRenameFixture(t)
+	kfs.SetConfig(Config{
+		Scope:       ScopeCluster,
+		AllowCreate: true,
+		AllowDelete: true,
+		DenyRules:   []FilterRule{{Kinds: []string{"ConfigMap"}, Names: []string{"secret-*"}}},
+	})
+	dev := namespaceNode(kfs, "dev")
+
+	errno := dev.Rename(context.Background(), "settings.configmap.core.v1.yaml", dev, "secret-settings.configmap.core.v1.yaml", 0)
+	if errno != syscall.EPERM {
+		t.Fatalf("expected EPERM, got %v", errno)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "create" || action.GetVerb() == "delete" {
+			t.Fatalf("expected nothing to change, got %s", action.GetVerb())
+		}
+	}
+}
+
+func TestRename_DeletesPodsWithoutEviction(t *testing.T) {
+	dev, client := newEvictFixture(t)
+	dev.KubeFS.SetConfig(Config{Scope: ScopeCluster, AllowCreate: true, AllowDelete: true, PodDeleteMode: PodDeleteModeEvict})
+
+	if errno := dev.Rename(context.Background(), "web-0.pod.core.v1.yaml", dev, "web-1.pod.core.v1.yaml", 0); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	for _, action := range client.Actions() {
+		if action.GetSubresource() == "eviction" {
+			t.Fatalf("expected the original to be deleted, not evicted")
+		}
+	}
+	if _, err := client.Resource(podsGVR).Namespace("dev").Get(context.Background(), "web-0", metav1.GetOptions{}); err == nil {
+		t.Fatalf("expected the original pod to be deleted")
+	}
+}
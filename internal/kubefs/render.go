@@ -0,0 +1,297 @@
+package kubefs
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/structured-merge-diff/v6/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v6/value"
+)
+
+// renderOptions are the rendering settings that apply to one kind.
+type renderOptions struct {
+	hideFields   [][]string
+	hideDefaults bool
+}
+
+func (o renderOptions) hidesAnything() bool {
+	return len(o.hideFields) > 0 || o.hideDefaults
+}
+
+// renderOptionsFor resolves the render settings for kind, applying its
+// per-kind override on top of the defaults.
+func renderOptionsFor(cfg RenderConfig, kind string) renderOptions {
+	fields := cfg.HideFields
+	hideDefaults := cfg.HideDefaults
+	for name, override := range cfg.Kinds {
+		if !strings.EqualFold(name, kind) {
+			continue
+		}
+		if override.HideFields != nil {
+			fields = override.HideFields
+		}
+		if override.HideDefaults != nil {
+			hideDefaults = *override.HideDefaults
+		}
+	}
+
+	options := renderOptions{hideDefaults: hideDefaults}
+	for _, field := range fields {
+		path, err := parseFieldPath(field)
+		if err != nil {
+			continue
+		}
+		options.hideFields = append(options.hideFields, path)
+	}
+	return options
+}
+
+func validateRender(cfg RenderConfig) error {
+	fields := append([]string{}, cfg.HideFields...)
+	for _, override := range cfg.Kinds {
+		fields = append(fields, override.HideFields...)
+	}
+	for _, field := range fields {
+		if _, err := parseFieldPath(field); err != nil {
+			return fmt.Errorf("invalid render.hideFields entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseFieldPath splits a dotted field path. Keys containing dots, such as
+// annotation names, are written in brackets:
+// metadata.annotations[kubectl.kubernetes.io/last-applied-configuration].
+func parseFieldPath(field string) ([]string, error) {
+	var path []string
+	rest := strings.TrimSpace(field)
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 2 {
+				return nil, fmt.Errorf("invalid field path %q", field)
+			}
+			path = append(path, rest[1:end])
+			rest = strings.TrimPrefix(rest[end+1:], ".")
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end == 0 {
+				return nil, fmt.Errorf("invalid field path %q", field)
+			}
+			if end < 0 {
+				end = len(rest)
+			}
+			path = append(path, rest[:end])
+			rest = strings.TrimPrefix(rest[end:], ".")
+		}
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty field path")
+	}
+	return path, nil
+}
+
+// renderObject removes the hidden fields from obj in place.
+func renderObject(obj *unstructured.Unstructured, options renderOptions) {
+	if options.hideDefaults {
+		if owned := ownedFields(obj); owned != nil {
+			obj.Object = pruneUnowned(obj.Object, owned)
+		}
+	}
+	for _, path := range options.hideFields {
+		unstructured.RemoveNestedField(obj.Object, path...)
+	}
+}
+
+// ownedFields returns the fields set by any field manager. Fields missing
+// from the set were filled in by the API server, e.g. defaults. It returns
+// nil when the object has no managedFields to go by.
+func ownedFields(obj *unstructured.Unstructured) *fieldpath.Set {
+	entries := obj.GetManagedFields()
+	if len(entries) == 0 {
+		return nil
+	}
+	owned := &fieldpath.Set{}
+	for _, entry := range entries {
+		if entry.FieldsV1 == nil {
+			continue
+		}
+		set := &fieldpath.Set{}
+		if err := set.FromJSON(bytes.NewReader(entry.FieldsV1.Raw)); err != nil {
+			Debugf("Ignoring unreadable managedFields entry of %s: %v", obj.GetName(), err)
+			continue
+		}
+		owned = owned.Union(set)
+	}
+	for _, field := range []string{"apiVersion", "kind"} {
+		owned.Insert(fieldpath.MakePathOrDie(field))
+	}
+	for _, field := range []string{"name", "namespace", "managedFields"} {
+		owned.Insert(fieldpath.MakePathOrDie("metadata", field))
+	}
+	return owned
+}
+
+func pruneUnowned(object map[string]interface{}, owned *fieldpath.Set) map[string]interface{} {
+	result := make(map[string]interface{}, len(object))
+	for key, child := range object {
+		element := fieldpath.FieldNameElement(key)
+		if children, ok := owned.Children.Get(element); ok {
+			result[key] = pruneValue(child, children)
+		} else if owned.Members.Has(element) {
+			result[key] = child
+		}
+	}
+	return result
+}
+
+func pruneValue(child interface{}, owned *fieldpath.Set) interface{} {
+	switch typed := child.(type) {
+	case map[string]interface{}:
+		return pruneUnowned(typed, owned)
+	case []interface{}:
+		result := make([]interface{}, 0, len(typed))
+		for index, item := range typed {
+			if children := matchListItem(owned, index, item); children != nil {
+				result = append(result, pruneValue(item, children))
+			} else if listItemOwned(owned, index, item) {
+				result = append(result, item)
+			}
+		}
+		return result
+	}
+	return child
+}
+
+// matchListItem returns the owned children of a list item, matched by its
+// key fields, value or index.
+func matchListItem(owned *fieldpath.Set, index int, item interface{}) *fieldpath.Set {
+	var found *fieldpath.Set
+	owned.Children.Iterate(func(element fieldpath.PathElement) {
+		if found == nil && elementMatches(element, index, item) {
+			found, _ = owned.Children.Get(element)
+		}
+	})
+	return found
+}
+
+func listItemOwned(owned *fieldpath.Set, index int, item interface{}) bool {
+	matched := false
+	owned.Members.Iterate(func(element fieldpath.PathElement) {
+		if !matched && elementMatches(element, index, item) {
+			matched = true
+		}
+	})
+	return matched
+}
+
+func elementMatches(element fieldpath.PathElement, index int, item interface{}) bool {
+	switch {
+	case element.Index != nil:
+		return *element.Index == index
+	case element.Value != nil:
+		return value.Equals(*element.Value, value.NewValueInterface(item))
+	case element.Key != nil:
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for _, key := range *element.Key {
+			field, exists := fields[key.Name]
+			if !exists || !value.Equals(key.Value, value.NewValueInterface(field)) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// restoreHidden puts the fields that rendering hid from live back into obj,
+// so saving a cleaned view does not drop them. Fields the user kept win.
+func restoreHidden(obj *unstructured.Unstructured, live *unstructured.Unstructured, options renderOptions) {
+	rendered := live.DeepCopy()
+	renderObject(rendered, options)
+	hidden := hiddenParts(live.Object, rendered.Object)
+	if hidden == nil {
+		return
+	}
+	obj.Object = mergeHidden(obj.Object, hidden).(map[string]interface{})
+}
+
+// hiddenParts returns the parts of live that are missing from rendered.
+// List items are compared by position.
+func hiddenParts(live interface{}, rendered interface{}) interface{} {
+	switch typed := live.(type) {
+	case map[string]interface{}:
+		renderedMap, ok := rendered.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		result := make(map[string]interface{})
+		for key, child := range typed {
+			renderedChild, exists := renderedMap[key]
+			if !exists {
+				result[key] = child
+				continue
+			}
+			if part := hiddenParts(child, renderedChild); part != nil {
+				result[key] = part
+			}
+		}
+		if len(result) == 0 {
+			return nil
+		}
+		return result
+	case []interface{}:
+		renderedList, ok := rendered.([]interface{})
+		if !ok || len(renderedList) != len(typed) {
+			return nil
+		}
+		result := make([]interface{}, len(typed))
+		changed := false
+		for index := range typed {
+			result[index] = hiddenParts(typed[index], renderedList[index])
+			changed = changed || result[index] != nil
+		}
+		if !changed {
+			return nil
+		}
+		return result
+	}
+	return nil
+}
+
+func mergeHidden(target interface{}, hidden interface{}) interface{} {
+	switch typed := hidden.(type) {
+	case map[string]interface{}:
+		targetMap, ok := target.(map[string]interface{})
+		if !ok {
+			return target
+		}
+		for key, part := range typed {
+			existing, exists := targetMap[key]
+			if !exists {
+				targetMap[key] = part
+				continue
+			}
+			targetMap[key] = mergeHidden(existing, part)
+		}
+		return targetMap
+	case []interface{}:
+		targetList, ok := target.([]interface{})
+		if !ok || len(targetList) != len(typed) {
+			return target
+		}
+		for index, part := range typed {
+			if part != nil {
+				targetList[index] = mergeHidden(targetList[index], part)
+			}
+		}
+		return targetList
+	}
+	return target
+}
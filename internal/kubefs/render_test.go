@@ -0,0 +1,169 @@
+package kubefs
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	path, err := parseFieldPath("metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration"}
+	if !reflect.DeepEqual(path, expected) {
+		t.Fatalf("unexpected path: %v", path)
+	}
+	for _, invalid := range []string{"", "metadata..uid", "metadata.[]"} {
+		if _, err := parseFieldPath(invalid); err == nil {
+			t.Fatalf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestRenderOptionsFor_KindOverrides(t *testing.T) {
+	hideDefaults := false
+	cfg := RenderConfig{
+		HideFields:   []string{"status"},
+		HideDefaults: true,
+		Kinds: map[string]KindRenderConfig{
+			"Pod": {HideFields: []string{}, HideDefaults: &hideDefaults},
+		},
+	}
+
+	deployment := renderOptionsFor(cfg, "Deployment")
+	if len(deployment.hideFields) != 1 || !deployment.hideDefaults {
+		t.Fatalf("expected defaults for deployments, got %+v", deployment)
+	}
+	if pod := renderOptionsFor(cfg, "pod"); pod.hidesAnything() {
+		t.Fatalf("expected pod override to show every field, got %+v", pod)
+	}
+}
+
+const renderTestDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: dev
+  uid: "1234"
+  resourceVersion: "42"
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: "{}"
+    team: checkout
+  managedFields:
+    - manager: kubectl
+      operation: Apply
+      fieldsType: FieldsV1
+      fieldsV1:
+        f:metadata:
+          f:annotations:
+            f:team: {}
+        f:spec:
+          f:replicas: {}
+          f:template:
+            f:spec:
+              f:containers:
+                k:{"name":"web"}:
+                  .: {}
+                  f:image: {}
+                  f:name: {}
+spec:
+  replicas: 2
+  revisionHistoryLimit: 10
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx
+          imagePullPolicy: Always
+status:
+  replicas: 2
+`
+
+func decodeTestObject(t *testing.T, data string) *unstructured.Unstructured {
+	t.Helper()
+	jsonData, err := yaml.YAMLToJSON([]byte(data))
+	if err != nil {
+		t.Fatalf("invalid test object: %v", err)
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(jsonData); err != nil {
+		t.Fatalf("invalid test object: %v", err)
+	}
+	return obj
+}
+
+func TestRenderObject_HidesFieldsAndDefaults(t *testing.T) {
+	obj := decodeTestObject(t, renderTestDeployment)
+	renderObject(obj, renderOptionsFor(RenderConfig{
+		HideFields: []string{
+			"status",
+			"metadata.uid",
+			"metadata.resourceVersion",
+			"metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]",
+		},
+		HideDefaults: true,
+	}, "Deployment"))
+	obj.SetManagedFields(nil)
+
+	expected := decodeTestObject(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: dev
+  annotations:
+    team: checkout
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx
+`)
+	if !reflect.DeepEqual(obj.Object, expected.Object) {
+		t.Fatalf("unexpected rendering:\n%v", obj.Object)
+	}
+}
+
+func TestRestoreHidden_KeepsUserEdits(t *testing.T) {
+	live := decodeTestObject(t, renderTestDeployment)
+	options := renderOptionsFor(RenderConfig{HideFields: []string{"status", "metadata.uid"}, HideDefaults: true}, "Deployment")
+	edited := live.DeepCopy()
+	renderObject(edited, options)
+	unstructured.SetNestedField(edited.Object, int64(3), "spec", "replicas")
+	containers, _, _ := unstructured.NestedSlice(edited.Object, "spec", "template", "spec", "containers")
+	containers[0].(map[string]interface{})["image"] = "nginx:1.27"
+	unstructured.SetNestedSlice(edited.Object, containers, "spec", "template", "spec", "containers")
+
+	restoreHidden(edited, live, options)
+
+	if replicas, _, _ := unstructured.NestedInt64(edited.Object, "spec", "replicas"); replicas != 3 {
+		t.Fatalf("expected user edit to win, got %d replicas", replicas)
+	}
+	if uid := edited.GetUID(); uid != "1234" {
+		t.Fatalf("expected hidden uid to be restored, got %q", uid)
+	}
+	if _, found, _ := unstructured.NestedMap(edited.Object, "status"); !found {
+		t.Fatalf("expected hidden status to be restored")
+	}
+	if limit, _, _ := unstructured.NestedInt64(edited.Object, "spec", "revisionHistoryLimit"); limit != 10 {
+		t.Fatalf("expected defaulted field to be restored, got %d", limit)
+	}
+	containers, _, _ = unstructured.NestedSlice(edited.Object, "spec", "template", "spec", "containers")
+	container := containers[0].(map[string]interface{})
+	if container["image"] != "nginx:1.27" || container["imagePullPolicy"] != "Always" {
+		t.Fatalf("unexpected container after restore: %v", container)
+	}
+}
+
+func TestParseConfig_RejectsInvalidRenderFields(t *testing.T) {
+	if _, err := ParseConfig([]byte("render:\n  kinds:\n    Pod:\n      hideFields: ['metadata..uid']\n")); err == nil {
+		t.Fatalf("expected error for invalid render field")
+	}
+}
@@ -0,0 +1,159 @@
+package kubefs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/yaml"
+)
+
+// immutableMessages are the messages of validation errors caused by changing
+// a field that cannot be updated in place.
+var immutableMessages = []string{
+	"field is immutable",
+	"updates to statefulset spec for fields other than",
+}
+
+const replacePollInterval = 200 * time.Millisecond
+
+// replacesOnImmutable reports whether objects of r's kind are replaced when
+// an update touches an immutable field.
+func (r *Resource) replacesOnImmutable() bool {
+	return matchValue(r.KubeFS.GetConfig().ReplaceOnImmutable.Kinds, r.GroupVersionKind.Kind)
+}
+
+func isImmutableError(err error) bool {
+	if !apierrors.IsInvalid(err) {
+		return false
+	}
+	messages := []string{err.Error()}
+	if status, ok := err.(apierrors.APIStatus); ok && status.Status().Details != nil {
+		for _, cause := range status.Status().Details.Causes {
+			messages = append(messages, cause.Message)
+		}
+	}
+	for _, message := range messages {
+		for _, immutable := range immutableMessages {
+			if strings.Contains(message, immutable) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// replace deletes the live object and creates obj in its place. The live
+// object is written to the backup directory first; if creating obj fails it
+// is restored from there, and the backup is kept either way.
+func (r *Resource) replace(ctx context.Context, obj *unstructured.Unstructured) syscall.Errno {
+	cfg := r.KubeFS.GetConfig().ReplaceOnImmutable
+	client := r.KubeFS.resourceInterface(r.GroupVersionResource, r.Namespace)
+
+	live, err := r.getResource(ctx)
+	if err != nil {
+		Errorf("Failed to fetch %s before replacing it: %v", r.logRef(), err)
+		return replaceErrno(err)
+	}
+	backup := live.DeepCopy()
+	stripServerMetadata(backup)
+	path, err := writeBackup(cfg.BackupDir, r, backup)
+	if err != nil {
+		Errorf("Not replacing %s, backup failed: %v", r.logRef(), err)
+		return syscall.EIO
+	}
+	Infof("Replacing %s to change immutable fields, backup in %s", r.logRef(), path)
+
+	options, errno := r.deleteOptions(ctx)
+	if errno != 0 {
+		return errno
+	}
+	if options.PropagationPolicy == nil {
+		// The API default orphans the pods of Jobs and similar owners; the
+		// replacement only starts once the old object and its dependents are
+		// gone.
+		policy := v1.DeletePropagationForeground
+		options.PropagationPolicy = &policy
+	}
+	uid := types.UID(live.GetUID())
+	options.Preconditions = &v1.Preconditions{UID: &uid}
+	if err := client.Delete(ctx, r.Name, options); err != nil && !apierrors.IsNotFound(err) {
+		Errorf("Failed to delete %s for replacement: %v", r.logRef(), err)
+		return replaceErrno(err)
+	}
+	timeout := cfg.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultReplaceTimeout
+	}
+	err = wait.PollUntilContextTimeout(ctx, replacePollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		_, err := client.Get(ctx, r.Name, v1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		Errorf("%s is still being deleted, not replaced; the new manifest was not applied: %v", r.logRef(), err)
+		return syscall.EBUSY
+	}
+
+	obj = obj.DeepCopy()
+	stripServerMetadata(obj)
+	created, err := client.Create(ctx, obj, v1.CreateOptions{})
+	if err != nil {
+		Errorf("Failed to create replacement for %s: %v", r.logRef(), err)
+		r.audit(ctx, "delete", live, nil)
+		if restored, restoreErr := client.Create(ctx, backup, v1.CreateOptions{}); restoreErr != nil {
+			Errorf("Failed to restore %s, recreate it from %s: %v", r.logRef(), path, restoreErr)
+		} else {
+			r.audit(ctx, "create", nil, restored)
+			Warnf("Restored %s from %s", r.logRef(), path)
+		}
+		return replaceErrno(err)
+	}
+	r.audit(ctx, "replace", live, created)
+	Infof("Replaced %s", r.logRef())
+	return 0
+}
+
+// replaceErrno maps a failure while replacing to an errno. EINVAL is not
+// used, since flush takes it for an incomplete draft and reports success.
+func replaceErrno(err error) syscall.Errno {
+	if errno := apiErrno(err); errno != syscall.EINVAL {
+		return errno
+	}
+	return syscall.EIO
+}
+
+// writeBackup stores the manifest of obj in dir, named after the file and
+// the time of the backup, and returns its path.
+func writeBackup(dir string, r *Resource, obj *unstructured.Unstructured) (string, error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "kubefs-backups")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	data, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return "", err
+	}
+	name := r.Filename()
+	if !r.Namespace.Clusterwide {
+		name = r.Namespace.Name + "_" + name
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s.%s", time.Now().UTC().Format("20060102T150405.000000000Z"), name))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
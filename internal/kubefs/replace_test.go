@@ -0,0 +1,183 @@
+package kubefs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+const editedSettings = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: dev
+  resourceVersion: "42"
+data:
+  key: edited
+`
+
+// rejectImmutableUpdates fails every update of a configmap the way the API
+// server rejects changes to immutable fields.
+func rejectImmutableUpdates(client *dynamicfake.FakeDynamicClient) {
+	client.PrependReactor("update", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, "settings",
+			field.ErrorList{field.Invalid(field.NewPath("data"), "edited", "field is immutable")})
+	})
+}
+
+func newReplaceFixture(t *testing.T, kinds ...string) (*Resource, *dynamicfake.FakeDynamicClient, string) {
+	t.Helper()
+	kfs, client := newRenameFixture(t)
+	backupDir := t.TempDir()
+	kfs.SetConfig(Config{Scope: ScopeCluster, ReplaceOnImmutable: ReplaceConfig{Kinds: kinds, BackupDir: backupDir}})
+	rejectImmutableUpdates(client)
+	return settingsResource(kfs), client, backupDir
+}
+
+func settingsValue(t *testing.T, client *dynamicfake.FakeDynamicClient) string {
+	t.Helper()
+	live, err := client.Resource(configMapsGVR).Namespace("dev").Get(context.Background(), "settings", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected settings to exist: %v", err)
+	}
+	value, _, _ := unstructured.NestedString(live.Object, "data", "key")
+	return value
+}
+
+func readBackups(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var backups []string
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.HasSuffix(entry.Name(), ".dev_"+settingsFile) {
+			t.Fatalf("unexpected backup name %s", entry.Name())
+		}
+		backups = append(backups, string(data))
+	}
+	return backups
+}
+
+func TestApplyYAML_ReplacesOnImmutable(t *testing.T) {
+	res, client, backupDir := newReplaceFixture(t, "configmap")
+
+	if errno := res.applyYAML(context.Background(), []byte(editedSettings)); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if value := settingsValue(t, client); value != "edited" {
+		t.Fatalf("expected the replacement to be created, got %q", value)
+	}
+	backups := readBackups(t, backupDir)
+	if len(backups) != 1 || !strings.Contains(backups[0], "key: value") || strings.Contains(backups[0], "resourceVersion") {
+		t.Fatalf("expected a backup of the old manifest, got %q", backups)
+	}
+}
+
+func TestApplyYAML_ReplaceDeletesDependents(t *testing.T) {
+	res, client, _ := newReplaceFixture(t, "configmap")
+	replaceDeletePolicy := func() metav1.DeletionPropagation {
+		for _, action := range client.Actions() {
+			if deletion, ok := action.(clienttesting.DeleteAction); ok {
+				if policy := deletion.GetDeleteOptions().PropagationPolicy; policy != nil {
+					return *policy
+				}
+				return ""
+			}
+		}
+		t.Fatalf("expected a delete, got %v", client.Actions())
+		return ""
+	}
+
+	if errno := res.applyYAML(context.Background(), []byte(editedSettings)); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if policy := replaceDeletePolicy(); policy != metav1.DeletePropagationForeground {
+		t.Fatalf("expected foreground propagation by default, got %q", policy)
+	}
+
+	client.ClearActions()
+	cfg := res.KubeFS.GetConfig()
+	cfg.Delete = DeleteConfig{PropagationPolicy: "Orphan"}
+	res.KubeFS.SetConfig(cfg)
+	if errno := res.applyYAML(context.Background(), []byte(editedSettings)); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if policy := replaceDeletePolicy(); policy != metav1.DeletePropagationOrphan {
+		t.Fatalf("expected the configured policy to be kept, got %q", policy)
+	}
+}
+
+func TestApplyYAML_ReplaceRestoresBackup(t *testing.T) {
+	res, client, backupDir := newReplaceFixture(t, "ConfigMap")
+	failed := false
+	client.PrependReactor("create", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if failed {
+			return false, nil, nil
+		}
+		failed = true
+		return true, nil, errors.New("boom")
+	})
+
+	if errno := res.applyYAML(context.Background(), []byte(editedSettings)); errno != syscall.EIO {
+		t.Fatalf("expected EIO, got %v", errno)
+	}
+	if value := settingsValue(t, client); value != "value" {
+		t.Fatalf("expected the old object to be restored, got %q", value)
+	}
+	if backups := readBackups(t, backupDir); len(backups) != 1 {
+		t.Fatalf("expected the backup to be kept, got %d", len(backups))
+	}
+}
+
+func TestApplyYAML_ReplaceCreateInvalidIsNotADraft(t *testing.T) {
+	res, client, _ := newReplaceFixture(t, "ConfigMap")
+	rejected := false
+	client.PrependReactor("create", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if rejected {
+			return false, nil, nil
+		}
+		rejected = true
+		return true, nil, apierrors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, "settings",
+			field.ErrorList{field.Invalid(field.NewPath("data"), "edited", "not allowed")})
+	})
+
+	if errno := res.applyYAML(context.Background(), []byte(editedSettings)); errno != syscall.EIO {
+		t.Fatalf("expected EIO, got %v", errno)
+	}
+	if value := settingsValue(t, client); value != "value" {
+		t.Fatalf("expected the old object to be restored, got %q", value)
+	}
+}
+
+func TestApplyYAML_ImmutableWithoutReplace(t *testing.T) {
+	res, client, backupDir := newReplaceFixture(t, "Job")
+
+	if errno := res.applyYAML(context.Background(), []byte(editedSettings)); errno != syscall.EINVAL {
+		t.Fatalf("expected EINVAL, got %v", errno)
+	}
+	if value := settingsValue(t, client); value != "value" {
+		t.Fatalf("expected the object to be untouched, got %q", value)
+	}
+	if backups := readBackups(t, backupDir); len(backups) != 0 {
+		t.Fatalf("expected no backup, got %d", len(backups))
+	}
+}
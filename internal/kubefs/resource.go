@@ -13,6 +13,7 @@ import (
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 	"sigs.k8s.io/yaml"
 )
 
@@ -24,8 +25,29 @@ type Resource struct {
 	KubeFS               *KubeFS
 
 	mu    sync.Mutex
-	data  []byte
-	dirty bool
+	draft []byte
+
+	// scratch marks an editor temporary file that only lives in memory; its
+	// content is kept in draft and Name is the full filename.
+	scratch bool
+
+	// generating marks a file created with a generateName filename until the
+	// object exists; Name still holds the name part of that filename.
+	generating bool
+
+	// alias is the short filename the file was created with, which it is
+	// listed under until the object is applied.
+	alias string
+
+	// xattrs holds the delete option overrides set on the file, and
+	// seenUID and seenResourceVersion the identity of the object last read,
+	// for delete preconditions.
+	xattrs              map[string]string
+	seenUID             string
+	seenResourceVersion string
+
+	// deletion describes a pending deletion held up by finalizers.
+	deletion string
 
 	changes   int
 	updatedAt time.Time
@@ -34,21 +56,25 @@ type Resource struct {
 }
 
 func (r *Resource) Filename() string {
+	if r.scratch {
+		return r.Name
+	}
+	return r.Name + "." + r.typeSuffix() + ".yaml"
+}
+
+// typeSuffix is the <kind>.<group>.<version> part of a resource filename.
+func (r *Resource) typeSuffix() string {
 	group := r.GroupVersionKind.Group
 	if group == "" {
 		group = "core"
 	}
-	return r.Name + "." + strings.ToLower(r.GroupVersionKind.Kind) + "." + strings.ToLower(group) + "." + r.GroupVersionKind.Version + ".yaml"
+	return strings.ToLower(r.GroupVersionKind.Kind) + "." + strings.ToLower(group) + "." + r.GroupVersionKind.Version
 }
 
 var _ = (fs.NodeGetattrer)((*Resource)(nil))
 var _ = (fs.FileStatxer)((*Resource)(nil))
 var _ = (fs.NodeOpener)((*Resource)(nil))
-var _ = (fs.NodeReader)((*Resource)(nil))
-var _ = (fs.NodeWriter)((*Resource)(nil))
 var _ = (fs.NodeSetattrer)((*Resource)(nil))
-var _ = (fs.NodeFlusher)((*Resource)(nil))
-var _ = (fs.NodeReleaser)((*Resource)(nil))
 
 func (r *Resource) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
 	Tracef("Getattr %s", r.Filename())
@@ -56,11 +82,12 @@ func (r *Resource) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrO
 	out.Uid = uint32(1000)
 	out.Gid = uint32(1000)
 
+	r.mu.Lock()
 	out.Mtime = uint64(r.updatedAt.UnixNano())
+	out.Size = r.reportedSize()
+	r.mu.Unlock()
 	out.Ctime = out.Mtime
 	out.Atime = out.Mtime
-
-	out.Size = 1024*1024 + uint64(r.changes)
 	return 0
 }
 
@@ -70,93 +97,35 @@ func (r *Resource) Statx(ctx context.Context, flags uint32, mask uint32, out *fu
 	out.Uid = uint32(1000)
 	out.Gid = uint32(1000)
 
+	r.mu.Lock()
 	out.Mtime = fuse.SxTime{Sec: uint64(r.updatedAt.Unix()), Nsec: uint32(r.updatedAt.Nanosecond())}
+	out.Size = r.reportedSize()
+	r.mu.Unlock()
 	out.Ctime = out.Mtime
 	out.Atime = out.Mtime
-
-	out.Size = 1024*1024 + uint64(r.changes)
 	return 0
 }
 
 func (r *Resource) Open(ctx context.Context, flags uint32) (fh fs.FileHandle, fuseFlags uint32, errno syscall.Errno) {
 	Tracef("Open %s flags=%d", r.Filename(), flags)
-	r.mu.Lock()
-	if r.data == nil || !r.dirty {
-		data, err := r.fetchYAML(ctx)
-		if err != nil {
-			r.mu.Unlock()
-			return nil, 0, syscall.EACCES
-		}
-		r.data = data
-	}
-	r.mu.Unlock()
-	return r, fuse.FOPEN_DIRECT_IO, fs.OK
-}
-
-func (r *Resource) Read(ctx context.Context, _ fs.FileHandle, dest []byte, offset int64) (fuse.ReadResult, syscall.Errno) {
-	Tracef("Read %s offset=%d size=%d", r.Filename(), offset, len(dest))
-	r.mu.Lock()
-	resp := r.data
-	if resp == nil || !r.dirty {
-		data, err := r.fetchYAML(ctx)
-		if err != nil {
-			r.mu.Unlock()
-			return nil, syscall.EACCES
-		}
-		r.data = data
-		resp = r.data
+	handle := &resourceHandle{
+		resource: r,
+		writable: flags&syscall.O_ACCMODE != syscall.O_RDONLY,
 	}
-	r.mu.Unlock()
-
-	if offset > int64(len(resp)) {
-		return fuse.ReadResultData(nil), 0
-	}
-
-	resp = resp[offset:]
-	if len(dest) < len(resp) {
-		resp = resp[:len(dest)]
+	if handle.writable && flags&syscall.O_TRUNC != 0 {
+		handle.dirty = true
+		return handle, fuse.FOPEN_DIRECT_IO, fs.OK
 	}
 
-	copy(dest, resp)
-	dest = dest[:len(resp)]
-	return fuse.ReadResultData(dest), 0
-}
-
-func (r *Resource) Write(ctx context.Context, fh fs.FileHandle, data []byte, offset int64) (uint32, syscall.Errno) {
-	Tracef("Write %s offset=%d size=%d", r.Filename(), offset, len(data))
-	if offset < 0 {
-		Warnf("Invalid offset for %s: %d", r.Filename(), offset)
-		return 0, syscall.EINVAL
-	}
-	maxInt := int64(^uint(0) >> 1)
-	if offset > maxInt {
-		Warnf("Offset too large for %s: %d", r.Filename(), offset)
-		return 0, syscall.EINVAL
+	data, err := r.snapshot(ctx)
+	if err != nil {
+		return nil, 0, syscall.EACCES
 	}
-
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	end := int(offset) + len(data)
-	if end > len(r.data) {
-		newData := make([]byte, end)
-		copy(newData, r.data)
-		r.data = newData
+	if flags&syscall.O_ACCMODE != syscall.O_WRONLY && !r.isScratch() && !r.isGenerating() {
+		r.auditRead(ctx)
 	}
-	copy(r.data[offset:], data)
-	r.dirty = true
-	r.changes++
-	return uint32(len(data)), 0
-}
-
-func (r *Resource) Flush(ctx context.Context, fh fs.FileHandle) syscall.Errno {
-	Tracef("Flush %s", r.Filename())
-	return r.flush(ctx)
-}
-
-func (r *Resource) Release(ctx context.Context, fh fs.FileHandle) syscall.Errno {
-	Tracef("Release %s", r.Filename())
-	return r.flush(ctx)
+	handle.data = data
+	return handle, fuse.FOPEN_DIRECT_IO, fs.OK
 }
 
 func (r *Resource) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
@@ -167,28 +136,65 @@ func (r *Resource) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAt
 		if in.Size > uint64(maxInt) {
 			return syscall.EINVAL
 		}
-		newSize := int(in.Size)
-		r.mu.Lock()
-		if newSize < len(r.data) {
-			r.data = r.data[:newSize]
-		} else if newSize > len(r.data) {
-			newData := make([]byte, newSize)
-			copy(newData, r.data)
-			r.data = newData
+		handle, ok := fh.(*resourceHandle)
+		if !ok && r.isScratch() {
+			r.truncateScratch(int(in.Size))
+			return r.Getattr(ctx, fh, out)
+		}
+		if !ok {
+			Warnf("Truncate of %s without an open handle is not supported", r.logRef())
+			return syscall.EPERM
+		}
+		if errno := handle.truncate(int(in.Size)); errno != 0 {
+			return errno
 		}
-		Tracef("Setattr %s newSize=%d", r.Filename(), len(r.data))
-		r.dirty = true
-		r.mu.Unlock()
 	}
 
 	return r.Getattr(ctx, fh, out)
 }
 
+// snapshot renders the current object for a new handle. Objects that do not
+// exist on the server yet fall back to the last unapplied draft.
+func (r *Resource) snapshot(ctx context.Context) ([]byte, error) {
+	if r.isScratch() || r.isGenerating() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return append([]byte(nil), r.draft...), nil
+	}
+	data, err := r.fetchYAML(ctx)
+	if err == nil {
+		return data, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.draft != nil && apierrors.IsNotFound(err) {
+		draft := make([]byte, len(r.draft))
+		copy(draft, r.draft)
+		return draft, nil
+	}
+	return nil, err
+}
+
+func (r *Resource) setDraft(data []byte) {
+	r.mu.Lock()
+	r.draft = data
+	r.mu.Unlock()
+}
+
+func (r *Resource) touch() {
+	r.mu.Lock()
+	r.changes++
+	r.updatedAt = time.Now()
+	r.mu.Unlock()
+}
+
 func (r *Resource) fetchYAML(ctx context.Context) ([]byte, error) {
 	resource, err := r.getResource(ctx)
 	if err != nil {
 		return nil, err
 	}
+	r.recordSeen(resource)
+	renderObject(resource, r.renderOptions())
 	r.maybeStripManagedFields(resource)
 	jsonData, err := resource.MarshalJSON()
 	if err != nil {
@@ -206,35 +212,6 @@ func (r *Resource) getResource(ctx context.Context) (*unstructured.Unstructured,
 	return client.Resource(r.GroupVersionResource).Namespace(r.Namespace.Name).Get(ctx, r.Name, v1.GetOptions{})
 }
 
-func (r *Resource) flush(ctx context.Context) syscall.Errno {
-	r.mu.Lock()
-	if !r.dirty {
-		r.mu.Unlock()
-		return 0
-	}
-	data := make([]byte, len(r.data))
-	copy(data, r.data)
-	r.mu.Unlock()
-
-	go func() {
-		time.Sleep(20 * time.Millisecond)
-		r.WriteCache(0, data)
-	}()
-
-	applyErr := r.applyYAML(ctx, data)
-	if applyErr == 0 {
-		r.mu.Lock()
-		r.dirty = false
-		r.mu.Unlock()
-		return 0
-	}
-	if applyErr == syscall.EINVAL {
-		Debugf("Deferred apply for %s due to invalid or incomplete content", r.logRef())
-		return 0
-	}
-	return applyErr
-}
-
 func (r *Resource) applyYAML(ctx context.Context, data []byte) syscall.Errno {
 	if len(data) == 0 {
 		Warnf("Empty write for %s", r.logRef())
@@ -258,7 +235,16 @@ func (r *Resource) applyYAML(ctx context.Context, data []byte) syscall.Errno {
 		obj.SetGroupVersionKind(r.GroupVersionKind)
 	}
 
-	if obj.GetName() == "" {
+	generating := r.isGenerating()
+	if generating {
+		if obj.GetName() != "" {
+			Warnf("Name set for %s, which is created with generateName", r.logRef())
+			return syscall.EINVAL
+		}
+		if obj.GetGenerateName() == "" {
+			obj.SetGenerateName(defaultGenerateName(r))
+		}
+	} else if obj.GetName() == "" {
 		obj.SetName(r.Name)
 	} else if obj.GetName() != r.Name {
 		Warnf("Name mismatch for %s: expected %s, got %s", r.logRef(), r.Name, obj.GetName())
@@ -276,31 +262,53 @@ func (r *Resource) applyYAML(ctx context.Context, data []byte) syscall.Errno {
 		}
 	}
 
+	options := r.renderOptions()
+	var before *unstructured.Unstructured
+	if !generating && (options.hidesAnything() || r.KubeFS.auditing()) {
+		live, err := r.getResource(ctx)
+		switch {
+		case err == nil:
+			before = live
+			restoreHidden(obj, live, options)
+		case !apierrors.IsNotFound(err) && options.hidesAnything():
+			Errorf("Failed to fetch %s to restore hidden fields: %v", r.logRef(), err)
+			return apiErrno(err)
+		}
+	}
+
+	var result *unstructured.Unstructured
 	var updateErr error
-	client := r.KubeFS.DynamicClient
-	if r.Namespace.Clusterwide {
-		_, updateErr = client.Resource(r.GroupVersionResource).Update(ctx, obj, v1.UpdateOptions{})
-	} else {
-		_, updateErr = client.Resource(r.GroupVersionResource).Namespace(r.Namespace.Name).Update(ctx, obj, v1.UpdateOptions{})
-	}
-	if updateErr != nil {
-		if apierrors.IsNotFound(updateErr) {
-			if r.Namespace.Clusterwide {
-				_, updateErr = client.Resource(r.GroupVersionResource).Create(ctx, obj, v1.CreateOptions{})
-			} else {
-				_, updateErr = client.Resource(r.GroupVersionResource).Namespace(r.Namespace.Name).Create(ctx, obj, v1.CreateOptions{})
-			}
+	operation := "update"
+	client := r.KubeFS.resourceInterface(r.GroupVersionResource, r.Namespace)
+	if generating {
+		created, err := client.Create(ctx, obj, v1.CreateOptions{})
+		if err == nil {
+			r.audit(ctx, "create", nil, created)
+			r.assignGeneratedName(created.GetName())
+			return 0
 		}
+		updateErr = err
+	} else {
+		result, updateErr = client.Update(ctx, obj, v1.UpdateOptions{})
+	}
+	if !generating && apierrors.IsNotFound(updateErr) {
+		operation = "create"
+		result, updateErr = client.Create(ctx, obj, v1.CreateOptions{})
 	}
 
 	if updateErr == nil {
+		r.audit(ctx, operation, before, result)
 		Infof("Applied %s", r.logRef())
+		r.settleAlias()
 		return 0
 	}
 	if apierrors.IsForbidden(updateErr) {
 		Errorf("Forbidden applying %s: %v", r.logRef(), updateErr)
 		return syscall.EACCES
 	}
+	if !generating && isImmutableError(updateErr) && r.replacesOnImmutable() {
+		return r.replace(ctx, obj)
+	}
 	if apierrors.IsInvalid(updateErr) {
 		Errorf("Invalid resource %s: %v", r.logRef(), updateErr)
 		return syscall.EINVAL
@@ -311,19 +319,49 @@ func (r *Resource) applyYAML(ctx context.Context, data []byte) syscall.Errno {
 }
 
 func (r *Resource) deleteResource(ctx context.Context) syscall.Errno {
+	return r.deleteObject(ctx, r.evicts())
+}
+
+// deleteObject deletes the object behind r, through the eviction API when
+// evict is set.
+func (r *Resource) deleteObject(ctx context.Context, evict bool) syscall.Errno {
 	if r.KubeFS == nil || r.KubeFS.DynamicClient == nil {
 		return syscall.EIO
 	}
-	client := r.KubeFS.DynamicClient
+	options, errno := r.deleteOptions(ctx)
+	if errno != 0 {
+		if errno == syscall.ENOENT {
+			return 0
+		}
+		return errno
+	}
+	var before *unstructured.Unstructured
+	if r.KubeFS.auditing() {
+		before, _ = r.getResource(ctx)
+	}
 	var err error
-	if r.Namespace.Clusterwide {
-		err = client.Resource(r.GroupVersionResource).Delete(ctx, r.Name, v1.DeleteOptions{})
+	operation := "delete"
+	if evict {
+		operation = "evict"
+		err = r.evictPod(ctx, options)
 	} else {
-		err = client.Resource(r.GroupVersionResource).Namespace(r.Namespace.Name).Delete(ctx, r.Name, v1.DeleteOptions{})
+		err = r.KubeFS.resourceInterface(r.GroupVersionResource, r.Namespace).Delete(ctx, r.Name, options)
+	}
+	if err == nil {
+		r.audit(ctx, operation, before, nil)
+		return 0
 	}
-	if err == nil || apierrors.IsNotFound(err) {
+	if apierrors.IsNotFound(err) {
 		return 0
 	}
+	if apierrors.IsTooManyRequests(err) {
+		Warnf("Eviction of %s blocked by disruption budget: %s", r.logRef(), r.blockingBudgets(ctx, err))
+		return syscall.EBUSY
+	}
+	if apierrors.IsConflict(err) {
+		Warnf("Precondition failed deleting %s, the object changed since it was read: %v", r.logRef(), err)
+		return syscall.ESTALE
+	}
 	if apierrors.IsForbidden(err) {
 		Errorf("Forbidden deleting %s: %v", r.logRef(), err)
 		return syscall.EACCES
@@ -336,6 +374,38 @@ func (r *Resource) deleteResource(ctx context.Context) syscall.Errno {
 	return syscall.EIO
 }
 
+// rename points the resource at a new object after a successful mv.
+func (r *Resource) rename(name string, namespace *Namespace) {
+	r.mu.Lock()
+	r.Name = name
+	r.Namespace = namespace
+	r.mu.Unlock()
+}
+
+func (k *KubeFS) resourceInterface(gvr schema.GroupVersionResource, namespace *Namespace) dynamic.ResourceInterface {
+	if namespace.Clusterwide {
+		return k.DynamicClient.Resource(gvr)
+	}
+	return k.DynamicClient.Resource(gvr).Namespace(namespace.Name)
+}
+
+// apiErrno maps an API error to the errno reported to the caller.
+func apiErrno(err error) syscall.Errno {
+	switch {
+	case err == nil:
+		return 0
+	case apierrors.IsNotFound(err):
+		return syscall.ENOENT
+	case apierrors.IsAlreadyExists(err):
+		return syscall.EEXIST
+	case apierrors.IsForbidden(err):
+		return syscall.EACCES
+	case apierrors.IsInvalid(err):
+		return syscall.EINVAL
+	}
+	return syscall.EIO
+}
+
 func (r *Resource) maybeStripManagedFields(obj *unstructured.Unstructured) {
 	if obj == nil || r.shouldShowManagedFields() {
 		return
@@ -343,6 +413,13 @@ func (r *Resource) maybeStripManagedFields(obj *unstructured.Unstructured) {
 	unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
 }
 
+func (r *Resource) renderOptions() renderOptions {
+	if r.KubeFS == nil {
+		return renderOptions{}
+	}
+	return renderOptionsFor(r.KubeFS.GetConfig().Render, r.GroupVersionKind.Kind)
+}
+
 func (r *Resource) shouldShowManagedFields() bool {
 	if r.KubeFS == nil {
 		return DefaultConfig().ShowManagedFields
@@ -351,6 +428,9 @@ func (r *Resource) shouldShowManagedFields() bool {
 }
 
 func (r *Resource) logRef() string {
+	if r.isScratch() && r.Namespace != nil {
+		return "scratch file " + r.Namespace.Name + "/" + r.Name
+	}
 	if r.Namespace == nil {
 		return r.GroupVersionKind.String() + "/" + r.Name
 	}
@@ -2,32 +2,96 @@ package kubefs
 
 import (
 	"context"
+	"os"
+	"strings"
 	"sync"
 	"syscall"
 
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/openapi"
 )
 
 type KubeFS struct {
 	fs.Inode
-	*dynamic.DynamicClient
+	DynamicClient   dynamic.Interface
 	DiscoveryClient discovery.DiscoveryInterface
+	MetadataClient  metadata.Interface
 	Config          Config
 	configMu        sync.RWMutex
+
+	informers           *informerManager
+	kubeClient          kubernetes.Interface
+	apiextensionsClient apiextensionsclientset.Interface
+	openAPIClient       openapi.Client
+	scopeMu             sync.Mutex
+	scope               *scopeInformers
+	reloadMu            sync.Mutex
+
+	matcher          *namespaceMatcher
+	filters          *filterSet
+	nsMu             sync.RWMutex
+	matched          map[string]struct{}
+	discoveryTrigger chan struct{}
+
+	// preferred holds the preferred resources found by the last discovery,
+	// used to resolve short filenames without asking the API server.
+	preferredMu sync.RWMutex
+	preferred   []*metav1.APIResourceList
+
+	// terminating holds the directories of namespaces deleted through rmdir
+	// until the informer reports them gone.
+	terminatingMu sync.Mutex
+	terminating   map[string]*fs.Inode
+
+	// cluster is the API server address, recorded in the audit log.
+	cluster    string
+	auditMu    sync.Mutex
+	auditFiles map[string]*os.File
+	reads      readAuditor
 }
 
 func NewKubeFS(config Config) *KubeFS {
-	return &KubeFS{
-		Config: config,
+	k := &KubeFS{
+		Config:           config,
+		matched:          make(map[string]struct{}),
+		discoveryTrigger: make(chan struct{}, 1),
+	}
+	k.matcher = buildNamespaceMatcher(config)
+	k.filters = buildFilterSet(config)
+	k.informers = newInformerManager(k)
+	return k
+}
+
+func buildNamespaceMatcher(config Config) *namespaceMatcher {
+	matcher, err := newNamespaceMatcher(config)
+	if err != nil {
+		Errorf("Ignoring namespace patterns: %v", err)
+		matcher, _ = newNamespaceMatcher(Config{})
 	}
+	return matcher
+}
+
+// Shutdown stops every informer started for this filesystem.
+func (k *KubeFS) Shutdown() {
+	k.informers.shutdown()
 }
 
 func (k *KubeFS) SetConfig(config Config) {
+	matcher := buildNamespaceMatcher(config)
+	filters := buildFilterSet(config)
 	k.configMu.Lock()
 	k.Config = config
+	k.matcher = matcher
+	k.filters = filters
 	k.configMu.Unlock()
 }
 
@@ -46,6 +110,9 @@ func (k *KubeFS) AllowedNamespaces() []string {
 	if k.IsClusterScope() {
 		return nil
 	}
+	if k.namespaceMatcher().dynamic() {
+		return k.matchedNamespaceList()
+	}
 	return k.GetConfig().Namespaces
 }
 
@@ -53,17 +120,170 @@ func (k *KubeFS) AllowsNamespace(name string) bool {
 	if k.IsClusterScope() {
 		return true
 	}
-	for _, ns := range k.GetConfig().Namespaces {
-		if ns == name {
-			return true
-		}
+	matcher := k.namespaceMatcher()
+	if matcher.dynamic() {
+		k.nsMu.RLock()
+		defer k.nsMu.RUnlock()
+		_, ok := k.matched[name]
+		return ok
 	}
-	return false
+	_, ok := matcher.names[name]
+	return ok
+}
+
+// UsesNamespaceInformer reports whether namespace scope needs to watch
+// namespaces to find the ones matching its patterns or selector.
+func (k *KubeFS) UsesNamespaceInformer() bool {
+	return !k.IsClusterScope() && k.namespaceMatcher().dynamic()
 }
 
 var _ = (fs.NodeGetattrer)((*KubeFS)(nil))
+var _ = (fs.NodeOnAdder)((*KubeFS)(nil))
+var _ = (fs.NodeLookuper)((*KubeFS)(nil))
+var _ = (fs.NodeOpendirer)((*KubeFS)(nil))
+
+// statusDir is the directory holding files kubefs exposes about itself.
+const statusDir = ".kubefs"
+
+func (k *KubeFS) OnAdd(ctx context.Context) {
+	dir := k.NewPersistentInode(ctx, &fs.Inode{}, fs.StableAttr{Mode: fuse.S_IFDIR})
+	k.AddChild(statusDir, dir, false)
+
+	syncFile := k.NewPersistentInode(ctx, newGeneratedFile(k.informers.syncReport), fs.StableAttr{Mode: fuse.S_IFREG})
+	dir.AddChild("sync", syncFile, false)
+
+	apply := k.NewPersistentInode(ctx, &applyDir{KubeFS: k}, fs.StableAttr{Mode: fuse.S_IFDIR})
+	k.AddChild(applyDirName, apply, false)
+}
 
 func (k *KubeFS) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
 	out.Mode = 0755
 	return 0
 }
+
+func (k *KubeFS) Opendir(ctx context.Context) syscall.Errno {
+	k.restoreTerminating()
+	return 0
+}
+
+func (k *KubeFS) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	k.restoreTerminating()
+	child := k.GetChild(name)
+	if child == nil {
+		return nil, syscall.ENOENT
+	}
+	if getter, ok := child.Operations().(fs.NodeGetattrer); ok {
+		var attr fuse.AttrOut
+		if errno := getter.Getattr(ctx, nil, &attr); errno == 0 {
+			out.Attr = attr.Attr
+		}
+	}
+	return child, 0
+}
+
+var _ = (fs.NodeMkdirer)((*KubeFS)(nil))
+var _ = (fs.NodeRmdirer)((*KubeFS)(nil))
+
+func (k *KubeFS) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	Debugf("Mkdir requested: %s", name)
+	cfg := k.GetConfig()
+	if !cfg.AllowCreate || !cfg.AllowNamespaceLifecycle {
+		Warnf("Namespace create blocked (allowCreate=%t, allowNamespaceLifecycle=%t): %s", cfg.AllowCreate, cfg.AllowNamespaceLifecycle, name)
+		return nil, syscall.EPERM
+	}
+	if !k.IsClusterScope() {
+		return nil, syscall.EPERM
+	}
+	if isReservedDirName(name) {
+		return nil, syscall.EINVAL
+	}
+	if k.GetChild(name) != nil {
+		return nil, syscall.EEXIST
+	}
+	if k.kubeClient == nil {
+		return nil, syscall.EIO
+	}
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	created, err := k.kubeClient.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	if err != nil {
+		return nil, namespaceErrno("creating", name, err)
+	}
+	k.auditMutation(ctx, "create", namespacesGVR, "", name, nil, toUnstructured(created))
+
+	k.AddNamespace(ctx, name, false)
+	inode := k.GetChild(name)
+	if inode == nil {
+		return nil, syscall.EIO
+	}
+	out.Attr.Mode = fuse.S_IFDIR | 0755
+	Infof("Created namespace %s", name)
+	return inode, 0
+}
+
+func (k *KubeFS) Rmdir(ctx context.Context, name string) syscall.Errno {
+	Debugf("Rmdir requested: %s", name)
+	cfg := k.GetConfig()
+	if !cfg.AllowDelete || !cfg.AllowNamespaceLifecycle {
+		Warnf("Namespace delete blocked (allowDelete=%t, allowNamespaceLifecycle=%t): %s", cfg.AllowDelete, cfg.AllowNamespaceLifecycle, name)
+		return syscall.EPERM
+	}
+	child := k.GetChild(name)
+	if child == nil {
+		return syscall.ENOENT
+	}
+	ns, ok := child.Operations().(*Namespace)
+	if !ok || ns.Clusterwide {
+		return syscall.EPERM
+	}
+	if k.kubeClient == nil {
+		return syscall.EIO
+	}
+	if !cfg.ForceNamespaceDelete {
+		holdsObjects, err := k.namespaceHoldsObjects(ctx, name)
+		if err != nil {
+			Errorf("Namespace delete refused, cannot tell whether %s is empty: %v", name, err)
+			return apiErrno(err)
+		}
+		if holdsObjects {
+			Warnf("Namespace delete refused, %s is not empty (set forceNamespaceDelete to override)", name)
+			return syscall.ENOTEMPTY
+		}
+	}
+
+	// The directory is kept before deleting, so that a deletion reported by
+	// the informer right away is not undone.
+	k.keepTerminating(name, child)
+	err := k.kubeClient.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil {
+		k.dropTerminating(name)
+		if !apierrors.IsNotFound(err) {
+			return namespaceErrno("deleting", name, err)
+		}
+		Infof("Deleted namespace %s", name)
+		return 0
+	}
+	k.auditMutation(ctx, "delete", namespacesGVR, "", name, nil, nil)
+	ns.SetPhase(string(corev1.NamespaceTerminating))
+	Infof("Deleting namespace %s, shown read-only until it is gone", name)
+	return 0
+}
+
+func isReservedDirName(name string) bool {
+	return name == "clusterwide" || strings.HasPrefix(name, ".")
+}
+
+func namespaceErrno(action string, name string, err error) syscall.Errno {
+	switch {
+	case apierrors.IsAlreadyExists(err):
+		return syscall.EEXIST
+	case apierrors.IsForbidden(err):
+		Errorf("Forbidden %s namespace %s: %v", action, name, err)
+		return syscall.EACCES
+	case apierrors.IsInvalid(err):
+		Errorf("Invalid namespace %s: %v", name, err)
+		return syscall.EINVAL
+	}
+	Errorf("Error %s namespace %s: %v", action, name, err)
+	return syscall.EIO
+}
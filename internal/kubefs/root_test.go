@@ -0,0 +1,182 @@
+package kubefs
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func newTestKubeFS(t *testing.T, cfg Config) *KubeFS {
+	t.Helper()
+	kfs := NewKubeFS(cfg)
+	fs.NewNodeFS(kfs, &fs.Options{})
+	t.Cleanup(kfs.Shutdown)
+	return kfs
+}
+
+func lifecycleConfig() Config {
+	return Config{
+		Scope:                   ScopeCluster,
+		AllowCreate:             true,
+		AllowDelete:             true,
+		AllowNamespaceLifecycle: true,
+	}
+}
+
+func TestMkdir_CreatesNamespace(t *testing.T) {
+	kfs := newTestKubeFS(t, lifecycleConfig())
+	client := fake.NewClientset()
+	kfs.kubeClient = client
+
+	inode, errno := kfs.Mkdir(context.Background(), "team-a", 0755, &fuse.EntryOut{})
+	if errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if inode == nil || kfs.GetChild("team-a") == nil {
+		t.Fatalf("expected namespace directory to be added")
+	}
+	if _, err := client.CoreV1().Namespaces().Get(context.Background(), "team-a", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected namespace to be created: %v", err)
+	}
+}
+
+func TestMkdir_RequiresLifecycleFlag(t *testing.T) {
+	cfg := lifecycleConfig()
+	cfg.AllowNamespaceLifecycle = false
+	kfs := newTestKubeFS(t, cfg)
+	kfs.kubeClient = fake.NewClientset()
+
+	if _, errno := kfs.Mkdir(context.Background(), "team-a", 0755, &fuse.EntryOut{}); errno != syscall.EPERM {
+		t.Fatalf("expected EPERM, got %v", errno)
+	}
+	if _, errno := NewKubeFS(lifecycleConfig()).Mkdir(context.Background(), ".hidden", 0755, &fuse.EntryOut{}); errno != syscall.EINVAL {
+		t.Fatalf("expected EINVAL for reserved name, got %v", errno)
+	}
+}
+
+// newNamespaceObject returns an object of kind in the team-a namespace.
+func newNamespaceObject(apiVersion string, kind string, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace("team-a")
+	obj.SetName(name)
+	return obj
+}
+
+// newLifecycleFixture mounts the team-a namespace, whose objects on the API
+// server are the given ones.
+func newLifecycleFixture(t *testing.T, cfg Config, objects ...runtime.Object) *KubeFS {
+	t.Helper()
+	kfs := newTestKubeFS(t, cfg)
+	kfs.kubeClient = fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}})
+	verbs := metav1.Verbs{"get", "list", "watch"}
+	kfs.DiscoveryClient = &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: verbs},
+				{Name: "serviceaccounts", Kind: "ServiceAccount", Namespaced: true, Verbs: verbs},
+				{Name: "events", Kind: "Event", Namespaced: true, Verbs: verbs},
+				{Name: "bindings", Kind: "Binding", Namespaced: true, Verbs: metav1.Verbs{"create"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: verbs},
+			},
+		},
+	}}}
+	kfs.DynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			configMapsGVR: "ConfigMapList",
+			{Version: "v1", Resource: "serviceaccounts"}:            "ServiceAccountList",
+			{Version: "v1", Resource: "events"}:                     "EventList",
+			{Group: "apps", Version: "v1", Resource: "deployments"}: "DeploymentList",
+		}, objects...)
+	kfs.AddNamespace(context.Background(), "team-a", false)
+	return kfs
+}
+
+func generatedNamespaceObjects() []runtime.Object {
+	return []runtime.Object{
+		newNamespaceObject("v1", "ConfigMap", "kube-root-ca.crt"),
+		newNamespaceObject("v1", "ServiceAccount", "default"),
+		newNamespaceObject("v1", "Event", "web.17a2b"),
+	}
+}
+
+func TestRmdir_DeletesNamespaceWithGeneratedObjects(t *testing.T) {
+	kfs := newLifecycleFixture(t, lifecycleConfig(), generatedNamespaceObjects()...)
+
+	if errno := kfs.Rmdir(context.Background(), "team-a"); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+}
+
+func TestRmdir_RefusesNamespaceWithDeniedObjects(t *testing.T) {
+	cfg := lifecycleConfig()
+	cfg.DenyRules = []FilterRule{{Kinds: []string{"Deployment"}}}
+	kfs := newLifecycleFixture(t, cfg, append(generatedNamespaceObjects(), newNamespaceObject("apps/v1", "Deployment", "web"))...)
+
+	if errno := kfs.Rmdir(context.Background(), "team-a"); errno != syscall.ENOTEMPTY {
+		t.Fatalf("expected ENOTEMPTY, got %v", errno)
+	}
+
+	cfg.ForceNamespaceDelete = true
+	kfs.SetConfig(cfg)
+	if errno := kfs.Rmdir(context.Background(), "team-a"); errno != 0 {
+		t.Fatalf("expected forced delete to succeed, got %v", errno)
+	}
+}
+
+func TestRmdir_RefusesLazyNamespaceNeverOpened(t *testing.T) {
+	cfg := lifecycleConfig()
+	cfg.Lazy = LazyConfig{Enabled: true}
+	kfs := newLifecycleFixture(t, cfg, newNamespaceObject("v1", "ConfigMap", "settings"))
+
+	if len(kfs.GetChild("team-a").Children()) != 0 {
+		t.Fatalf("expected the namespace to list no files before it is opened")
+	}
+	if errno := kfs.Rmdir(context.Background(), "team-a"); errno != syscall.ENOTEMPTY {
+		t.Fatalf("expected ENOTEMPTY, got %v", errno)
+	}
+}
+
+func TestRmdir_KeepsTerminatingNamespace(t *testing.T) {
+	kfs := newLifecycleFixture(t, lifecycleConfig())
+	inode := kfs.GetChild("team-a")
+
+	if errno := kfs.Rmdir(context.Background(), "team-a"); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	// The bridge drops the entry once rmdir succeeds.
+	kfs.RmChild("team-a")
+
+	var out fuse.EntryOut
+	child, errno := kfs.Lookup(context.Background(), "team-a", &out)
+	if errno != 0 || child != inode {
+		t.Fatalf("expected the terminating namespace to be listed again, got %v", errno)
+	}
+	if !child.Operations().(*Namespace).IsTerminating() || out.Attr.Mode != fuse.S_IFDIR|0555 {
+		t.Fatalf("expected a read-only terminating directory, got mode %o", out.Attr.Mode)
+	}
+
+	kfs.RemoveNamespace(context.Background(), "team-a")
+	if _, errno := kfs.Lookup(context.Background(), "team-a", &out); errno != syscall.ENOENT {
+		t.Fatalf("expected the namespace to go once deleted, got %v", errno)
+	}
+}
@@ -0,0 +1,249 @@
+package kubefs
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Editors save by writing a temporary file (.swp, 4913, ~ backups, .tmp)
+// and renaming it over the original. Files whose names are not resource
+// filenames are therefore kept in memory as scratch files, and renaming one
+// over a resource file applies its content to that resource.
+
+func (r *Resource) isScratch() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.scratch
+}
+
+// reportedSize is the size shown by stat. Resources are rendered on open, so
+// their size is unknown and a large size is reported to make readers read
+// until EOF. The caller must hold r.mu.
+func (r *Resource) reportedSize() uint64 {
+	if r.scratch {
+		return uint64(len(r.draft))
+	}
+	return 1024*1024 + uint64(r.changes)
+}
+
+func (r *Resource) truncateScratch(size int) {
+	r.mu.Lock()
+	if size < len(r.draft) {
+		r.draft = r.draft[:size]
+	} else if size > len(r.draft) {
+		data := make([]byte, size)
+		copy(data, r.draft)
+		r.draft = data
+	}
+	r.updatedAt = time.Now()
+	r.mu.Unlock()
+}
+
+func (n *Namespace) scratchFile(name string) *Resource {
+	child := n.GetChild(name)
+	if child == nil {
+		return nil
+	}
+	res, ok := child.Operations().(*Resource)
+	if !ok || !res.isScratch() {
+		return nil
+	}
+	return res
+}
+
+func (n *Namespace) createScratch(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	if n.IsTerminating() {
+		return nil, nil, 0, syscall.EROFS
+	}
+	if n.GetChild(name) != nil {
+		return nil, nil, 0, syscall.EEXIST
+	}
+
+	res := &Resource{
+		Name:      name,
+		Namespace: n,
+		KubeFS:    n.KubeFS,
+		scratch:   true,
+		updatedAt: time.Now(),
+	}
+	inode := n.NewPersistentInode(ctx, res, fs.StableAttr{Mode: fuse.S_IFREG})
+	n.AddChild(name, inode, false)
+	out.Attr.Mode = fuse.S_IFREG | 0664
+	Debugf("Created %s", res.logRef())
+	return inode, &resourceHandle{resource: res, writable: true}, fuse.FOPEN_DIRECT_IO, 0
+}
+
+// renameScratch handles mv of a scratch file. Renaming it to another scratch
+// name only renames it in memory. Renaming it to a resource filename applies
+// its content to that resource, and the scratch file becomes the resource
+// file.
+func (n *Namespace) renameScratch(ctx context.Context, scratch *Resource, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	if flags&fs.RENAME_EXCHANGE != 0 {
+		return syscall.EINVAL
+	}
+	target, ok := newParent.(*Namespace)
+	if !ok {
+		return syscall.EPERM
+	}
+	if n.IsTerminating() || target.IsTerminating() {
+		return syscall.EROFS
+	}
+
+	// A short target name is a resource filename only if its type resolves;
+	// the file is then listed under the full name.
+	filename := newName
+	var gvk schema.GroupVersionKind
+	var gvr schema.GroupVersionResource
+	resourceName, kindName, groupName, version, ok := parseResourceFilename(newName)
+	if !ok {
+		if _, _, short := parseShortFilename(newName); short && n.KubeFS.DiscoveryClient != nil {
+			name, resolved, kind, err := n.KubeFS.resolveFilename(newName)
+			switch {
+			case err == nil:
+				resourceName, ok = name, true
+				gvr = resolved
+				gvk = schema.GroupVersionKind{Group: resolved.Group, Version: resolved.Version, Kind: kind}
+				filename = (&Resource{Name: name, GroupVersionKind: gvk}).Filename()
+			case !errors.Is(err, errUnknownType):
+				Warnf("Failed to resolve resource for %s: %v", newName, err)
+				return syscall.EINVAL
+			}
+		}
+	}
+	if !ok {
+		if existing := target.GetChild(newName); existing != nil {
+			if res, ok := existing.Operations().(*Resource); !ok || !res.isScratch() {
+				return syscall.EPERM
+			}
+		}
+		scratch.rename(newName, target)
+		return 0
+	}
+
+	existing := target.GetChild(filename)
+	if existing != nil {
+		res, ok := existing.Operations().(*Resource)
+		if !ok || res.isScratch() {
+			return syscall.EPERM
+		}
+		gvk, gvr = res.GroupVersionKind, res.GroupVersionResource
+	} else {
+		if !n.KubeFS.GetConfig().AllowCreate {
+			Warnf("Create blocked (allowCreate=false): %s/%s", target.Name, newName)
+			return syscall.EPERM
+		}
+		if gvr.Resource == "" {
+			if n.KubeFS.DiscoveryClient == nil {
+				return syscall.EIO
+			}
+			resolved, kind, err := n.KubeFS.ResolveResource(groupName, version, kindName)
+			if err != nil {
+				Warnf("Failed to resolve resource for %s: %v", newName, err)
+				return syscall.EINVAL
+			}
+			gvk = schema.GroupVersionKind{Group: resolved.Group, Version: resolved.Version, Kind: kind}
+			gvr = resolved
+		}
+		if !n.KubeFS.allowsType(gvr, gvk.Kind, target.Clusterwide) {
+			Warnf("Create blocked by filters: %s/%s", target.Name, newName)
+			return syscall.EPERM
+		}
+	}
+	if !target.Clusterwide && !n.KubeFS.AllowsNamespace(target.Name) {
+		return syscall.EPERM
+	}
+
+	scratch.mu.Lock()
+	data := append([]byte(nil), scratch.draft...)
+	scratch.mu.Unlock()
+
+	res := &Resource{
+		Name:                 resourceName,
+		Namespace:            target,
+		GroupVersionKind:     gvk,
+		GroupVersionResource: gvr,
+		KubeFS:               n.KubeFS,
+	}
+	if errno := res.applyYAML(ctx, data); errno != 0 {
+		Warnf("Saving %s over %s failed", scratch.logRef(), res.logRef())
+		return errno
+	}
+
+	scratch.mu.Lock()
+	oldName := scratch.Name
+	scratch.Name = resourceName
+	scratch.Namespace = target
+	scratch.GroupVersionKind = gvk
+	scratch.GroupVersionResource = gvr
+	scratch.scratch = false
+	scratch.draft = nil
+	scratch.changes++
+	scratch.updatedAt = time.Now()
+	scratch.mu.Unlock()
+
+	if existing != nil {
+		existing.ForgetPersistent()
+	}
+	if filename != newName {
+		// The bridge then finds nothing left to move under newName.
+		n.MvChild(oldName, &target.Inode, filename, true)
+	}
+	Infof("Applied %s from an editor save", res.logRef())
+	return 0
+}
+
+// renameToScratch handles mv of a resource file to a name that is not a
+// resource filename, as editors do to keep a backup before saving. The object
+// is left alone: its content is copied into a new scratch file, and the
+// resource file is listed again by the next Lookup or Opendir.
+func (n *Namespace) renameToScratch(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	if flags&fs.RENAME_EXCHANGE != 0 {
+		return syscall.EINVAL
+	}
+	target, ok := newParent.(*Namespace)
+	if !ok {
+		return syscall.EPERM
+	}
+	if n.IsTerminating() || target.IsTerminating() {
+		return syscall.EROFS
+	}
+	child := n.GetChild(name)
+	if child == nil {
+		return syscall.ENOENT
+	}
+	res, ok := child.Operations().(*Resource)
+	if !ok {
+		return syscall.EPERM
+	}
+	if existing := target.GetChild(newName); existing != nil {
+		if scratch, ok := existing.Operations().(*Resource); !ok || !scratch.isScratch() {
+			return syscall.EPERM
+		}
+	}
+
+	data, err := res.snapshot(ctx)
+	if err != nil {
+		Errorf("Error reading %s before copying it to %s: %v", res.logRef(), newName, err)
+		return apiErrno(err)
+	}
+	scratch := &Resource{
+		Name:      newName,
+		Namespace: target,
+		KubeFS:    n.KubeFS,
+		scratch:   true,
+		draft:     data,
+		updatedAt: time.Now(),
+	}
+	// The bridge then moves whatever is listed under name to newName, so the
+	// scratch file takes the place of the resource file, which is held aside.
+	n.holdPending(name, child)
+	n.AddChild(name, n.NewPersistentInode(ctx, scratch, fs.StableAttr{Mode: fuse.S_IFREG}), true)
+	Debugf("Copied %s to %s", res.logRef(), scratch.logRef())
+	return 0
+}
@@ -0,0 +1,182 @@
+package kubefs
+
+import (
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func writeScratch(t *testing.T, ns *Namespace, name string, data string) *Resource {
+	t.Helper()
+	var out fuse.EntryOut
+	inode, handle, _, errno := ns.Create(context.Background(), name, 0, 0644, &out)
+	if errno != 0 {
+		t.Fatalf("create %s: unexpected errno: %v", name, errno)
+	}
+	fh := handle.(*resourceHandle)
+	if _, errno := fh.Write(context.Background(), []byte(data), 0); errno != 0 {
+		t.Fatalf("write %s: unexpected errno: %v", name, errno)
+	}
+	if errno := fh.Flush(context.Background()); errno != 0 {
+		t.Fatalf("flush %s: unexpected errno: %v", name, errno)
+	}
+	return inode.Operations().(*Resource)
+}
+
+func TestCreate_EditorScratchFiles(t *testing.T) {
+	kfs, _ := newRenameFixture(t)
+	dev := namespaceNode(kfs, "dev")
+
+	for _, name := range []string{"4913", ".settings.configmap.core.v1.yaml.swp", "settings.configmap.core.v1.yaml~"} {
+		scratch := writeScratch(t, dev, name, "hello")
+		if !scratch.isScratch() || scratch.Filename() != name {
+			t.Fatalf("expected %s to be a scratch file, got %q", name, scratch.Filename())
+		}
+		if got, err := scratch.snapshot(context.Background()); err != nil || string(got) != "hello" {
+			t.Fatalf("expected scratch content to be kept, got %q (%v)", got, err)
+		}
+		var attr fuse.AttrOut
+		if errno := scratch.Getattr(context.Background(), nil, &attr); errno != 0 || attr.Size != 5 {
+			t.Fatalf("expected size 5, got %d (errno %v)", attr.Size, errno)
+		}
+		if errno := dev.Unlink(context.Background(), name); errno != 0 {
+			t.Fatalf("unlink %s: unexpected errno: %v", name, errno)
+		}
+		if dev.GetChild(name) != nil {
+			t.Fatalf("expected %s to be removed", name)
+		}
+	}
+}
+
+func TestUnlink_ScratchWithoutAllowDelete(t *testing.T) {
+	kfs, _ := newRenameFixture(t)
+	kfs.SetConfig(Config{Scope: ScopeCluster, AllowCreate: true})
+	dev := namespaceNode(kfs, "dev")
+
+	writeScratch(t, dev, "4913", "")
+	if errno := dev.Unlink(context.Background(), "4913"); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if errno := dev.Unlink(context.Background(), "settings.configmap.core.v1.yaml"); errno != syscall.EPERM {
+		t.Fatalf("expected EPERM for resource files, got %v", errno)
+	}
+}
+
+func TestRename_ScratchOverResourceApplies(t *testing.T) {
+	kfs, client := newRenameFixture(t)
+	dev := namespaceNode(kfs, "dev")
+	data := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  namespace: dev\ndata:\n  key: saved\n"
+	writeScratch(t, dev, "settings.configmap.core.v1.yaml.tmp", data)
+
+	errno := dev.Rename(context.Background(), "settings.configmap.core.v1.yaml.tmp", dev, "settings.configmap.core.v1.yaml", 0)
+	if errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	obj, err := client.Resource(configMapsGVR).Namespace("dev").Get(context.Background(), "settings", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value := obj.Object["data"].(map[string]interface{})["key"]; value != "saved" {
+		t.Fatalf("expected saved content to be applied, got %v", value)
+	}
+}
+
+func TestRename_ScratchToScratch(t *testing.T) {
+	kfs, _ := newRenameFixture(t)
+	dev := namespaceNode(kfs, "dev")
+	scratch := writeScratch(t, dev, "notes.tmp", "draft")
+
+	if errno := dev.Rename(context.Background(), "notes.tmp", dev, "notes.bak", 0); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if scratch.Filename() != "notes.bak" || !scratch.isScratch() {
+		t.Fatalf("expected scratch file to be renamed in memory, got %q", scratch.Filename())
+	}
+}
+
+func TestRename_InvalidScratchIsNotApplied(t *testing.T) {
+	kfs, client := newRenameFixture(t)
+	dev := namespaceNode(kfs, "dev")
+	writeScratch(t, dev, "4913", "not: [yaml")
+
+	if errno := dev.Rename(context.Background(), "4913", dev, "settings.configmap.core.v1.yaml", 0); errno == 0 {
+		t.Fatalf("expected invalid content to be rejected")
+	}
+	obj, err := client.Resource(configMapsGVR).Namespace("dev").Get(context.Background(), "settings", metav1.GetOptions{})
+	if err != nil || obj.Object["data"].(map[string]interface{})["key"] != "value" {
+		t.Fatalf("expected live object to be unchanged: %v", err)
+	}
+}
+
+func TestRename_ScratchToShortFilenameApplies(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{Scope: ScopeCluster, AllowCreate: true})
+	kfs.DiscoveryClient = newShortNameDiscovery()
+	kfs.DynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{deploymentsGVR: "DeploymentList"})
+	kfs.AddNamespace(context.Background(), "dev", false)
+	dev := namespaceNode(kfs, "dev")
+	scratch := writeScratch(t, dev, "web.tmp", "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: dev\n")
+
+	if errno := dev.Rename(context.Background(), "web.tmp", dev, "web.deploy.yaml", 0); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	if _, err := kfs.DynamicClient.Resource(deploymentsGVR).Namespace("dev").Get(context.Background(), "web", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected deployment to be created: %v", err)
+	}
+	if scratch.isScratch() {
+		t.Fatalf("expected the scratch file to become the resource file")
+	}
+	if names := childNames(dev); len(names) != 1 || names[0] != "web.deployment.apps.v1.yaml" {
+		t.Fatalf("expected the file to be listed under its full name, got %v", names)
+	}
+}
+
+func TestRename_ResourceToBackupKeepsObject(t *testing.T) {
+	kfs, client := newRenameFixture(t)
+	kfs.SetConfig(Config{Scope: ScopeCluster})
+	dev := namespaceNode(kfs, "dev")
+	original := dev.GetChild(settingsFile)
+
+	// vim with backupcopy=auto moves the file aside before writing it anew.
+	if errno := dev.Rename(context.Background(), settingsFile, dev, settingsFile+"~", 0); errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	dev.MvChild(settingsFile, dev.EmbeddedInode(), settingsFile+"~", true)
+
+	backup := dev.scratchFile(settingsFile + "~")
+	if backup == nil {
+		t.Fatalf("expected the backup to be a scratch file")
+	}
+	if data, err := backup.snapshot(context.Background()); err != nil || !strings.Contains(string(data), "key: value") {
+		t.Fatalf("expected the backup to hold the manifest, got %q (%v)", data, err)
+	}
+	var out fuse.EntryOut
+	if child, errno := dev.Lookup(context.Background(), settingsFile, &out); errno != 0 || child != original {
+		t.Fatalf("expected the resource file to be listed again, got %v", errno)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() != "get" {
+			t.Fatalf("expected the object to be left alone, got %v", action)
+		}
+	}
+
+	if errno := dev.Unlink(context.Background(), settingsFile+"~"); errno != 0 {
+		t.Fatalf("unexpected errno removing the backup: %v", errno)
+	}
+}
+
+func TestRmdir_IgnoresScratchFiles(t *testing.T) {
+	kfs := newLifecycleFixture(t, lifecycleConfig(), generatedNamespaceObjects()...)
+	writeScratch(t, namespaceNode(kfs, "team-a"), ".notes.swp", "draft")
+
+	if errno := kfs.Rmdir(context.Background(), "team-a"); errno != 0 {
+		t.Fatalf("expected a namespace holding only scratch files to be removed, got %v", errno)
+	}
+}
@@ -0,0 +1,271 @@
+package kubefs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// maxSkeletonDepth bounds how deep required fields are followed, since
+// schemas such as JSONSchemaProps refer to themselves.
+const maxSkeletonDepth = 6
+
+// resourceSkeleton is the initial content of a new file. A template
+// configured for the resource wins; otherwise the required fields of the
+// resource's OpenAPI v3 schema are filled with placeholders.
+func (k *KubeFS) resourceSkeleton(res *Resource) string {
+	header := buildResourceSkeleton(res)
+	if path, ok := templateFor(k.GetConfig().Templates, res.GroupVersionResource); ok {
+		data, err := renderTemplate(path, res)
+		if err == nil {
+			return data
+		}
+		Warnf("Ignoring template %s for %s: %v", path, res.logRef(), err)
+	}
+
+	schemas, err := k.openAPISchemas(res.GroupVersionKind.GroupVersion())
+	if err != nil {
+		Debugf("No OpenAPI schema for %s: %v", res.logRef(), err)
+		return header
+	}
+	return header + schemaSkeleton(schemas, res.GroupVersionKind)
+}
+
+// templateKey is the key of Config.Templates for a resource:
+// <resource>.<group>, or just <resource> for the core group.
+func templateKey(gvr schema.GroupVersionResource) string {
+	if gvr.Group == "" {
+		return strings.ToLower(gvr.Resource)
+	}
+	return strings.ToLower(gvr.Resource + "." + gvr.Group)
+}
+
+func templateFor(templates map[string]string, gvr schema.GroupVersionResource) (string, bool) {
+	path, ok := templates[templateKey(gvr)]
+	return path, ok && path != ""
+}
+
+// renderTemplate reads a template file and points it at the new object.
+func renderTemplate(path string, res *Resource) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return "", err
+	}
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	if err := json.Unmarshal(jsonData, &obj.Object); err != nil || obj.Object == nil {
+		return "", errors.New("template is not a YAML object")
+	}
+	obj.SetGroupVersionKind(res.GroupVersionKind)
+	if res.generating {
+		obj.SetName("")
+		obj.SetGenerateName(defaultGenerateName(res))
+	} else {
+		obj.SetName(res.Name)
+	}
+	if res.Namespace != nil && !res.Namespace.Clusterwide {
+		obj.SetNamespace(res.Namespace.Name)
+	}
+	out, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// openAPISchemas returns the component schemas of the OpenAPI v3 document
+// of a group version.
+func (k *KubeFS) openAPISchemas(gv schema.GroupVersion) (map[string]interface{}, error) {
+	if k.openAPIClient == nil {
+		return nil, errors.New("OpenAPI client not configured")
+	}
+	paths, err := k.openAPIClient.Paths()
+	if err != nil {
+		return nil, err
+	}
+	key := "apis/" + gv.Group + "/" + gv.Version
+	if gv.Group == "" {
+		key = "api/" + gv.Version
+	}
+	groupVersion, ok := paths[key]
+	if !ok {
+		return nil, fmt.Errorf("no OpenAPI v3 document for %s", key)
+	}
+	data, err := groupVersion.Schema(runtime.ContentTypeJSON)
+	if err != nil {
+		return nil, err
+	}
+	var document struct {
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	return document.Components.Schemas, nil
+}
+
+// schemaSkeleton renders the spec and the required top-level fields of a
+// kind as YAML, with typed placeholders and the allowed values of enums in
+// comments.
+func schemaSkeleton(schemas map[string]interface{}, gvk schema.GroupVersionKind) string {
+	root := findKindSchema(schemas, gvk)
+	if root == nil {
+		return ""
+	}
+	builder := &skeletonBuilder{schemas: schemas}
+	properties, _ := root["properties"].(map[string]interface{})
+	names := requiredFields(root)
+	if _, ok := properties["spec"]; ok && !slices.Contains(names, "spec") {
+		names = append(names, "spec")
+	}
+	for _, name := range names {
+		switch name {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+		builder.field(name, properties[name], 0, 0)
+	}
+	if len(builder.lines) == 0 {
+		return ""
+	}
+	return strings.Join(builder.lines, "\n") + "\n"
+}
+
+func findKindSchema(schemas map[string]interface{}, gvk schema.GroupVersionKind) map[string]interface{} {
+	for _, candidate := range schemas {
+		node, ok := candidate.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kinds, _ := node["x-kubernetes-group-version-kind"].([]interface{})
+		for _, entry := range kinds {
+			fields, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if fields["group"] == gvk.Group && fields["version"] == gvk.Version && fields["kind"] == gvk.Kind {
+				return node
+			}
+		}
+	}
+	return nil
+}
+
+type skeletonBuilder struct {
+	schemas map[string]interface{}
+	lines   []string
+}
+
+func (b *skeletonBuilder) field(name string, node interface{}, indent int, depth int) {
+	resolved := b.resolve(node)
+	pad := strings.Repeat("  ", indent)
+	switch schemaType(resolved) {
+	case "object":
+		if depth >= maxSkeletonDepth || len(requiredFields(resolved)) == 0 {
+			b.lines = append(b.lines, pad+name+": {}")
+			return
+		}
+		b.lines = append(b.lines, pad+name+":")
+		b.object(resolved, indent+1, depth+1)
+	case "array":
+		items := b.resolve(resolved["items"])
+		if schemaType(items) != "object" || len(requiredFields(items)) == 0 || depth >= maxSkeletonDepth {
+			b.lines = append(b.lines, pad+name+": []")
+			return
+		}
+		b.lines = append(b.lines, pad+name+":")
+		start := len(b.lines)
+		b.object(items, indent+2, depth+1)
+		// Turn the first field of the item into the list entry.
+		b.lines[start] = pad + "  - " + strings.TrimPrefix(b.lines[start], pad+"    ")
+	default:
+		b.lines = append(b.lines, pad+name+": "+placeholder(resolved)+enumComment(resolved))
+	}
+}
+
+func (b *skeletonBuilder) object(node map[string]interface{}, indent int, depth int) {
+	properties, _ := node["properties"].(map[string]interface{})
+	for _, name := range requiredFields(node) {
+		b.field(name, properties[name], indent, depth)
+	}
+}
+
+// resolve follows $ref and the single-entry allOf wrappers OpenAPI v3 uses
+// for references with a description or default.
+func (b *skeletonBuilder) resolve(node interface{}) map[string]interface{} {
+	current, _ := node.(map[string]interface{})
+	for range maxSkeletonDepth {
+		if current == nil {
+			return nil
+		}
+		if allOf, ok := current["allOf"].([]interface{}); ok && len(allOf) == 1 {
+			current, _ = allOf[0].(map[string]interface{})
+			continue
+		}
+		ref, _ := current["$ref"].(string)
+		if ref == "" {
+			return current
+		}
+		current, _ = b.schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{})
+	}
+	return current
+}
+
+func schemaType(node map[string]interface{}) string {
+	if node == nil {
+		return ""
+	}
+	if kind, _ := node["type"].(string); kind != "" {
+		return kind
+	}
+	if _, ok := node["properties"]; ok {
+		return "object"
+	}
+	return ""
+}
+
+func requiredFields(node map[string]interface{}) []string {
+	values, _ := node["required"].([]interface{})
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if name, ok := value.(string); ok {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+func placeholder(node map[string]interface{}) string {
+	switch schemaType(node) {
+	case "integer", "number":
+		return "0"
+	case "boolean":
+		return "false"
+	}
+	return `""`
+}
+
+func enumComment(node map[string]interface{}) string {
+	values, _ := node["enum"].([]interface{})
+	if len(values) == 0 {
+		return ""
+	}
+	options := make([]string, 0, len(values))
+	for _, value := range values {
+		options = append(options, fmt.Sprint(value))
+	}
+	return " # one of: " + strings.Join(options, ", ")
+}
@@ -0,0 +1,145 @@
+package kubefs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/openapi"
+	"k8s.io/client-go/openapi/openapitest"
+)
+
+const podOpenAPI = `{
+  "components": {
+    "schemas": {
+      "io.k8s.api.core.v1.Pod": {
+        "type": "object",
+        "x-kubernetes-group-version-kind": [{"group": "", "version": "v1", "kind": "Pod"}],
+        "properties": {
+          "apiVersion": {"type": "string"},
+          "kind": {"type": "string"},
+          "metadata": {"allOf": [{"$ref": "#/components/schemas/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"}]},
+          "spec": {"allOf": [{"$ref": "#/components/schemas/io.k8s.api.core.v1.PodSpec"}]},
+          "status": {"type": "object"}
+        }
+      },
+      "io.k8s.api.core.v1.PodSpec": {
+        "type": "object",
+        "required": ["containers", "restartPolicy"],
+        "properties": {
+          "containers": {"type": "array", "items": {"allOf": [{"$ref": "#/components/schemas/io.k8s.api.core.v1.Container"}]}},
+          "restartPolicy": {"type": "string", "enum": ["Always", "OnFailure", "Never"]},
+          "nodeName": {"type": "string"}
+        }
+      },
+      "io.k8s.api.core.v1.Container": {
+        "type": "object",
+        "required": ["name", "ports"],
+        "properties": {
+          "name": {"type": "string"},
+          "ports": {"type": "array", "items": {"$ref": "#/components/schemas/io.k8s.api.core.v1.ContainerPort"}}
+        }
+      },
+      "io.k8s.api.core.v1.ContainerPort": {
+        "type": "object",
+        "required": ["containerPort"],
+        "properties": {"containerPort": {"type": "integer"}}
+      },
+      "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {"type": "object"}
+    }
+  }
+}`
+
+var podsGVR = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+func TestSchemaSkeleton(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{Scope: ScopeCluster})
+	kfs.openAPIClient = &openapitest.FakeClient{PathsMap: map[string]openapi.GroupVersion{
+		"api/v1": openapitest.FakeGroupVersion{GVSpec: []byte(podOpenAPI)},
+	}}
+	kfs.AddNamespace(context.Background(), "dev", false)
+	res := &Resource{
+		Name:                 "web",
+		Namespace:            namespaceNode(kfs, "dev"),
+		GroupVersionKind:     schema.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		GroupVersionResource: podsGVR,
+	}
+
+	expected := `apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+  namespace: dev
+spec:
+  containers:
+    - name: ""
+      ports:
+        - containerPort: 0
+  restartPolicy: "" # one of: Always, OnFailure, Never
+`
+	if got := kfs.resourceSkeleton(res); got != expected {
+		t.Fatalf("unexpected skeleton:\n%s", got)
+	}
+}
+
+func TestSchemaSkeleton_FallsBackWithoutSchema(t *testing.T) {
+	kfs := newTestKubeFS(t, Config{Scope: ScopeCluster})
+	kfs.AddNamespace(context.Background(), "dev", false)
+	res := &Resource{
+		Name:             "web",
+		Namespace:        namespaceNode(kfs, "dev"),
+		GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "Pod"},
+	}
+	if got := kfs.resourceSkeleton(res); got != buildResourceSkeleton(res) {
+		t.Fatalf("expected the plain skeleton, got:\n%s", got)
+	}
+}
+
+func TestCreate_UsesTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configmap.yaml")
+	template := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: placeholder\n  labels:\n    team: platform\ndata:\n  LOG_LEVEL: info\n"
+	if err := os.WriteFile(path, []byte(template), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kfs, _ := newRenameFixture(t)
+	kfs.DiscoveryClient = newCoreDiscovery()
+	cfg := kfs.GetConfig()
+	cfg.Templates = map[string]string{"configmaps": path}
+	kfs.SetConfig(cfg)
+	dev := namespaceNode(kfs, "dev")
+
+	var out fuse.EntryOut
+	_, handle, _, errno := dev.Create(context.Background(), "app.configmap.core.v1.yaml", 0, 0644, &out)
+	if errno != 0 {
+		t.Fatalf("unexpected errno: %v", errno)
+	}
+	data := string(handle.(*resourceHandle).data)
+	for _, expected := range []string{"name: app\n", "namespace: dev\n", "team: platform\n", "LOG_LEVEL: info\n"} {
+		if !strings.Contains(data, expected) {
+			t.Fatalf("expected %q in skeleton:\n%s", expected, data)
+		}
+	}
+}
+
+func TestLoadConfig_TemplatePaths(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kubefs.yaml")
+	data := "templates:\n  Deployments.apps: ./templates/deploy.yaml\n  configmaps.core: /etc/kubefs/cm.yaml\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Templates["deployments.apps"] != filepath.Join(dir, "templates", "deploy.yaml") {
+		t.Fatalf("expected relative path to be resolved against the config file, got %v", cfg.Templates)
+	}
+	if cfg.Templates["configmaps"] != "/etc/kubefs/cm.yaml" {
+		t.Fatalf("expected core group to be dropped from the key, got %v", cfg.Templates)
+	}
+}